@@ -3,13 +3,12 @@ package ratelimit
 import (
 	"context"
 	"errors"
+	"iter"
+	"math"
 	"sync"
 	"time"
-)
 
-var (
-	ErrAutoKeyAlreadyExists = errors.New("key already exists")
-	ErrAutoKeyMissing       = errors.New("key does not exist")
+	"github.com/projectdiscovery/utils/errkit"
 )
 
 // AutoLimiterOption is a function that configures the AutoLimiter
@@ -36,6 +35,69 @@ func WithMaxCount(maxCount uint) AutoLimiterOption {
 	}
 }
 
+// WithFIFO serves the waiters of each key in arrival order regardless of their priority
+func WithFIFO() AutoLimiterOption {
+	return func(e *AutoLimiter) {
+		e.defaultOptions.FIFO = true
+	}
+}
+
+// WithMaxQueue fails the waits of each key with ErrQueueFull once n callers are waiting
+func WithMaxQueue(n int) AutoLimiterOption {
+	return func(e *AutoLimiter) {
+		e.defaultOptions.MaxQueue = n
+	}
+}
+
+// WithMaxWait fails the waits of each key with ErrWaitTimeout once they take longer than d
+func WithMaxWait(d time.Duration) AutoLimiterOption {
+	return func(e *AutoLimiter) {
+		e.defaultOptions.MaxWait = d
+	}
+}
+
+// WithWarmup ramps the limit of every new key limiter from the start of w to the maximum count
+func WithWarmup(w Warmup) AutoLimiterOption {
+	return func(e *AutoLimiter) {
+		e.defaultOptions.Warmup = &w
+	}
+}
+
+// WithParent sets the limiter tokens are taken from once the key limiter grants one
+func WithParent(parent *Limiter) AutoLimiterOption {
+	return func(e *AutoLimiter) {
+		e.defaultOptions.Parent = parent
+	}
+}
+
+// WithParentKey sets a keyed parent level, tokens are taken from the parent key
+// derived from each key once the key limiter grants one
+func WithParentKey(parent *AutoLimiter, derive func(key string) string) AutoLimiterOption {
+	return func(e *AutoLimiter) {
+		e.defaultOptions.ParentLimiter = parent
+		e.defaultOptions.ParentKey = derive
+	}
+}
+
+// WithRules appends rules consulted in order before the defaults when a key
+// is created automatically, the first matching rule sets the options of the key,
+// unlike SetRules the rules are checked when the keys they match are created
+// and the keys matching an invalid rule fail with its error
+func WithRules(rules ...Rule) AutoLimiterOption {
+	return func(e *AutoLimiter) {
+		for _, r := range rules {
+			e.rules = append(e.rules, newRule(r))
+		}
+	}
+}
+
+// WithNormalizer sets the normalizer applied to the keys on every call
+func WithNormalizer(normalize Normalizer) AutoLimiterOption {
+	return func(e *AutoLimiter) {
+		e.normalize = normalize
+	}
+}
+
 // AutoLimiter is an improved version of MultiLimiter with better memory management
 type AutoLimiter struct {
 	limiters sync.Map // map of active limiters
@@ -44,6 +106,12 @@ type AutoLimiter struct {
 
 	// Default options for automatically created limiters
 	defaultOptions *internalOptions
+	// rules override the defaults for the keys they match
+	rules      []rule
+	defaultsMu sync.RWMutex
+
+	// normalize maps the keys of the callers to the keys of the limiters
+	normalize Normalizer
 }
 
 // NewAutoLimiter creates a new auto limiter instance using functional options
@@ -63,84 +131,280 @@ func NewAutoLimiter(ctx context.Context, opts ...AutoLimiterOption) *AutoLimiter
 	return e
 }
 
-// internalOptions holds configuration internally (not exposed to users)
+// internalOptions are the options of a key with the keyed parent level only AutoLimiter supports
 type internalOptions struct {
-	Key         string
-	IsUnlimited bool
-	MaxCount    uint
-	Duration    time.Duration
+	Options
+	// ParentLimiter and ParentKey define a keyed parent level
+	ParentLimiter *AutoLimiter
+	ParentKey     func(key string) string
 }
 
-// Validate internal options
-func (o *internalOptions) Validate() error {
-	if !o.IsUnlimited {
-		if o.Key == "" {
-			return errors.New("empty keys not allowed")
-		}
-		if o.MaxCount == 0 {
-			return errors.New("maxcount cannot be zero")
-		}
-		if o.Duration == 0 {
-			return errors.New("time duration not set")
+// buildOptions applies the functional options to the options of key
+func buildOptions(key string, opts []AutoLimiterOption) (*internalOptions, error) {
+	return applyOptions(&internalOptions{Options: Options{Key: key}}, opts)
+}
+
+// applyOptions applies the functional options over options, the options
+// of the whole AutoLimiter are rejected since they would be dropped
+func applyOptions(options *internalOptions, opts []AutoLimiterOption) (*internalOptions, error) {
+	for _, opt := range opts {
+		// Create a temporary limiter to apply the option
+		tempLimiter := &AutoLimiter{defaultOptions: options}
+		opt(tempLimiter)
+		if len(tempLimiter.rules) > 0 || tempLimiter.normalize != nil {
+			return nil, errkit.New("autolimiter: WithRules and WithNormalizer only apply to NewAutoLimiter")
 		}
 	}
-	return nil
+	return options, nil
 }
 
 // Add creates a new rate limiter with custom settings (only for keys that need specific limits)
 func (e *AutoLimiter) Add(key string, opts ...AutoLimiterOption) error {
 	// Create options struct and apply functional options to it
-	options := &internalOptions{Key: key}
-
-	// Apply all options to the options struct
-	for _, opt := range opts {
-		// Create a temporary limiter to apply the option
-		tempLimiter := &AutoLimiter{defaultOptions: options}
-		opt(tempLimiter)
+	options, err := buildOptions(e.normalizeKey(key), opts)
+	if err != nil {
+		return err
 	}
+	return e.add(options)
+}
 
+// add creates the limiter of the normalized key of options with its custom settings
+func (e *AutoLimiter) add(options *internalOptions) error {
 	// Validate the configuration
-	if !options.IsUnlimited {
-		if key == "" {
-			return errors.New("empty keys not allowed")
-		}
-		if options.MaxCount == 0 {
-			return errors.New("maxcount cannot be zero")
-		}
-		if options.Duration == 0 {
-			return errors.New("time duration not set")
-		}
+	if err := options.Validate(); err != nil {
+		return err
 	}
 
 	// Check if key already exists
-	if _, exists := e.limiters.Load(key); exists {
-		return ErrAutoKeyAlreadyExists
+	if _, exists := e.limiters.Load(options.Key); exists {
+		return ErrKeyAlreadyExists
 	}
 
 	// Create new limiter with custom settings
-	var rlimiter *Limiter
-	if options.IsUnlimited {
-		rlimiter = NewUnlimited(e.ctx)
-	} else {
-		rlimiter = New(e.ctx, options.MaxCount, options.Duration)
+	rlimiter := options.newLimiter(e.ctx)
+
+	// Store the limiter and options unless the key was created concurrently
+	if _, loaded := e.limiters.LoadOrStore(options.Key, rlimiter); loaded {
+		rlimiter.Stop()
+		return ErrKeyAlreadyExists
+	}
+	e.options.Store(options.Key, options)
+
+	return nil
+}
+
+// GetLimit returns current ratelimit of given key or the default one for keys without a limiter
+func (e *AutoLimiter) GetLimit(key string) (uint, error) {
+	key = e.normalizeKey(key)
+	if limiter, err := e.get(key); err == nil {
+		return limiter.GetLimit(), nil
+	}
+	opts, err := e.optionsOf(key)
+	if err != nil {
+		return 0, err
+	}
+	if opts.IsUnlimited {
+		return math.MaxUint32, nil
+	}
+	return opts.MaxCount, nil
+}
+
+// Update the settings of an existing key, its limiter is reconfigured in place
+// keeping the waiters and the tokens spent in the current window
+func (e *AutoLimiter) Update(key string, opts ...AutoLimiterOption) error {
+	options, err := buildOptions(e.normalizeKey(key), opts)
+	if err != nil {
+		return err
+	}
+	return e.update(options)
+}
+
+// update reconfigures the limiter of the normalized key of options in place,
+// the current window gets the new limit minus the tokens already spent
+func (e *AutoLimiter) update(options *internalOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	limiter, err := e.get(options.Key)
+	if _, hasOptions := e.options.Load(options.Key); err != nil && !hasOptions {
+		return ErrKeyMissing
+	}
+	if limiter != nil {
+		if err := options.configure(limiter, true); err != nil {
+			return err
+		}
+	}
+	// the key has custom settings from now on
+	e.options.Store(options.Key, options)
+	return nil
+}
+
+// configureKey updates the key of opts or adds it if missing
+func (e *AutoLimiter) configureKey(opts *Options) error {
+	options := &internalOptions{Options: *opts}
+	options.Key = e.normalizeKey(opts.Key)
+	err := e.update(options)
+	if errors.Is(err, ErrKeyMissing) {
+		err = e.add(options)
+	}
+	return err
+}
+
+// SetDefaults changes the settings of the keys created automatically from now on, the default
+// settings not overridden by opts are kept and a max count or a duration replaces an unlimited
+// default, PropagateDefaults applies them to the existing keys as well
+func (e *AutoLimiter) SetDefaults(opts ...AutoLimiterOption) error {
+	e.defaultsMu.Lock()
+	defer e.defaultsMu.Unlock()
+	// find out whether opts set a limit
+	probe, err := applyOptions(&internalOptions{}, opts)
+	if err != nil {
+		return err
+	}
+	current := *e.defaultOptions
+	if probe.MaxCount != 0 || probe.Duration != 0 {
+		current.IsUnlimited = false
+	}
+	options, err := applyOptions(&current, opts)
+	if err != nil {
+		return err
 	}
+	if err := options.validateLimits(); err != nil {
+		return err
+	}
+	e.defaultOptions = options
+	return nil
+}
+
+// PropagateDefaults reconfigures in place the existing keys without custom settings
+// with the current rules and defaults, a lower limit applies to their current window
+func (e *AutoLimiter) PropagateDefaults() error {
+	return e.refresh()
+}
 
-	// Store the limiter and options
-	e.limiters.Store(key, rlimiter)
-	e.options.Store(key, options)
+// refresh reconfigures in place the existing keys without custom settings
+// with the matching rule or the default options
+func (e *AutoLimiter) refresh() error {
+	return refreshKeys(&e.limiters, &e.options, func(key string) (*Options, error) {
+		opts, err := e.defaultsOf(key)
+		if err != nil {
+			return nil, err
+		}
+		return &opts.Options, nil
+	})
+}
 
+// SetRules replaces the rules, keys created automatically from now on use them
+func (e *AutoLimiter) SetRules(rules ...Rule) error {
+	compiled := make([]rule, 0, len(rules))
+	for i, r := range rules {
+		compiled = append(compiled, newRule(r))
+		if err := compiled[i].validate(); err != nil {
+			return errkit.Wrapf(err, "rule: %d", i)
+		}
+	}
+	e.defaultsMu.Lock()
+	e.rules = compiled
+	e.defaultsMu.Unlock()
 	return nil
 }
 
 // Take one token from bucket - creates limiter automatically if it doesn't exist
 func (e *AutoLimiter) Take(key string) error {
+	return e.TakeContext(context.Background(), key)
+}
+
+// TakeContext takes one token from bucket or returns the context error if it is done
+// before a token is available - creates limiter automatically if it doesn't exist
+func (e *AutoLimiter) TakeContext(ctx context.Context, key string) error {
+	_, err := e.reserve(ctx, key, PriorityNormal)
+	return err
+}
+
+// TakeWithPriority takes one token from bucket serving higher priorities first or returns
+// the context error if it is done before a token is available - creates limiter automatically if it doesn't exist
+func (e *AutoLimiter) TakeWithPriority(ctx context.Context, key string, priority Priority) error {
+	_, err := e.reserve(ctx, key, priority)
+	return err
+}
+
+// Reserve takes one token from bucket like TakeContext and returns its reservation, canceling it
+// gives the token back to the key and its parents - creates limiter automatically if it doesn't exist
+func (e *AutoLimiter) Reserve(ctx context.Context, key string) (*Reservation, error) {
+	return e.reserve(ctx, key, PriorityNormal)
+}
+
+// reserve takes one token of key and then of its parent key if any
+func (e *AutoLimiter) reserve(ctx context.Context, key string, priority Priority) (*Reservation, error) {
+	key = e.normalizeKey(key)
+	limiter, err := e.getOrCreate(key)
+	if err != nil {
+		return nil, err
+	}
+	reservation, err := limiter.reserve(ctx, priority)
+	if err != nil {
+		return nil, err
+	}
+	if parent, parentKey := e.parentOf(key); parent != nil {
+		parentReservation, err := parent.reserve(ctx, parentKey, priority)
+		if err != nil {
+			// the token of the key is not used
+			reservation.Cancel()
+			return nil, err
+		}
+		reservation.join(parentReservation)
+	}
+	return reservation, nil
+}
+
+// TryTake takes one token from bucket without waiting and reports whether it succeeded
+// - creates limiter automatically if it doesn't exist
+func (e *AutoLimiter) TryTake(key string) (bool, error) {
+	_, ok, err := e.TryReserve(key)
+	return ok, err
+}
+
+// TryReserve takes one token from bucket like TryTake and returns its reservation, canceling it
+// gives the token back to the key and its parents - creates limiter automatically if it doesn't exist
+func (e *AutoLimiter) TryReserve(key string) (*Reservation, bool, error) {
+	key = e.normalizeKey(key)
+	limiter, err := e.getOrCreate(key)
+	if err != nil {
+		return nil, false, err
+	}
+	parent, parentKey := e.parentOf(key)
+	// don't spend a token of the key when the parent can't grant one
+	if parent != nil && !parent.CanTake(parentKey) {
+		return nil, false, nil
+	}
+	reservation, ok := limiter.TryReserve()
+	if !ok {
+		return nil, false, nil
+	}
+	if parent != nil {
+		parentReservation, ok, err := parent.TryReserve(parentKey)
+		if !ok {
+			// the parent drained in the meantime
+			reservation.Cancel()
+			return nil, false, err
+		}
+		reservation.join(parentReservation)
+	}
+	return reservation, true, nil
+}
+
+// CanTake checks if the rate limiter with the given key and its parents have any token
+func (e *AutoLimiter) CanTake(key string) bool {
+	key = e.normalizeKey(key)
+	if parent, parentKey := e.parentOf(key); parent != nil && !parent.CanTake(parentKey) {
+		return false
+	}
 	limiter, err := e.get(key)
 	if err != nil {
-		// Key doesn't exist, create it with default settings
-		limiter = e.createOrDefault(key)
+		// a new limiter starts with a full bucket
+		return true
 	}
-	limiter.Take()
-	return nil
+	return limiter.CanTake()
 }
 
 // Stop internal limiters with defined keys or all if no key is provided
@@ -157,6 +421,7 @@ func (e *AutoLimiter) Stop(keys ...string) {
 		return
 	}
 	for _, v := range keys {
+		v = e.normalizeKey(v)
 		if limiter, err := e.get(v); err == nil {
 			limiter.Stop()
 			e.limiters.Delete(v)
@@ -167,6 +432,7 @@ func (e *AutoLimiter) Stop(keys ...string) {
 
 // Remove completely removes a key and its options
 func (e *AutoLimiter) Remove(key string) {
+	key = e.normalizeKey(key)
 	// Stop and remove the limiter if it exists
 	if limiter, err := e.get(key); err == nil {
 		limiter.Stop()
@@ -180,12 +446,12 @@ func (e *AutoLimiter) Remove(key string) {
 func (e *AutoLimiter) get(key string) (*Limiter, error) {
 	val, _ := e.limiters.Load(key)
 	if val == nil {
-		return nil, ErrAutoKeyMissing
+		return nil, ErrKeyMissing
 	}
 	if limiter, ok := val.(*Limiter); ok {
 		return limiter, nil
 	}
-	return nil, errors.New("type assertion of rateLimiter failed in autoLimiter")
+	return nil, errkit.New("autolimiter: type assertion of rateLimiter failed")
 }
 
 // recreateLimiter recreates a limiter from stored options
@@ -193,64 +459,119 @@ func (e *AutoLimiter) recreateLimiter(key string) (*Limiter, error) {
 	// Check if we have stored options for this key
 	optsVal, exists := e.options.Load(key)
 	if !exists {
-		return nil, ErrAutoKeyMissing
+		return nil, ErrKeyMissing
 	}
 
 	opts, ok := optsVal.(*internalOptions)
 	if !ok {
-		return nil, errors.New("invalid options type")
+		return nil, errkit.New("autolimiter: invalid options type")
 	}
 
 	// Create new limiter with stored options
-	var rlimiter *Limiter
-	if opts.IsUnlimited {
-		rlimiter = NewUnlimited(e.ctx)
-	} else {
-		rlimiter = New(e.ctx, opts.MaxCount, opts.Duration)
-	}
-
-	// Store the new limiter
-	e.limiters.Store(key, rlimiter)
+	return e.store(key, opts.newLimiter(e.ctx)), nil
+}
 
-	return rlimiter, nil
+// getOrCreate returns the limiter of key creating it if needed
+func (e *AutoLimiter) getOrCreate(key string) (*Limiter, error) {
+	if limiter, err := e.get(key); err == nil {
+		return limiter, nil
+	}
+	// Key doesn't exist, create it with default settings
+	return e.createOrDefault(key)
 }
 
-// createOrDefault creates a new limiter with default settings
-func (e *AutoLimiter) createOrDefault(key string) *Limiter {
+// createOrDefault creates a new limiter with default settings, it fails
+// when the matching rule or the defaults don't set valid limits
+func (e *AutoLimiter) createOrDefault(key string) (*Limiter, error) {
 	// First check if we have stored custom options for this key
 	if optsVal, exists := e.options.Load(key); exists {
 		if _, ok := optsVal.(*internalOptions); ok {
 			// Recreate with stored custom options
 			if limiter, err := e.recreateLimiter(key); err == nil {
-				return limiter
+				return limiter, nil
 			}
 			// If recreation fails, fall back to defaults
 		}
 	}
 
-	// No custom options, create with stored default options
-	var limiter *Limiter
-	if e.defaultOptions.IsUnlimited {
-		limiter = NewUnlimited(e.ctx)
-	} else {
-		limiter = New(e.ctx, e.defaultOptions.MaxCount, e.defaultOptions.Duration)
+	// No custom options, create with the matching rule or the default options
+	opts, err := e.defaultsOf(key)
+	if err == nil {
+		err = opts.validateLimits()
 	}
-
-	// Store the limiter
-	e.limiters.Store(key, limiter)
+	if err != nil {
+		return nil, errkit.Wrapf(err, "key: %v", key)
+	}
+	limiter := e.store(key, opts.newLimiter(e.ctx))
 
 	// Note: We don't store options for default limiters since they can be recreated
 	// Only custom limiters (added via Add()) get their options stored
 
+	return limiter, nil
+}
+
+// store the limiter of key unless another caller already did, the limiter in use is returned
+func (e *AutoLimiter) store(key string, limiter *Limiter) *Limiter {
+	if val, loaded := e.limiters.LoadOrStore(key, limiter); loaded {
+		limiter.Stop()
+		if existing, ok := val.(*Limiter); ok {
+			return existing
+		}
+	}
 	return limiter
 }
 
+// Keys returns the sorted keys that were added or used
+func (e *AutoLimiter) Keys() []string {
+	return keysOf(&e.limiters, &e.options)
+}
+
+// Len returns the number of keys that were added or used
+func (e *AutoLimiter) Len() int {
+	return len(e.Keys())
+}
+
+// All returns an iterator over the keys and their info
+func (e *AutoLimiter) All() iter.Seq2[string, KeyInfo] {
+	return func(yield func(string, KeyInfo) bool) {
+		for _, key := range e.Keys() {
+			info, err := e.Info(key)
+			if err != nil {
+				// removed in the meantime
+				continue
+			}
+			if !yield(key, info) {
+				return
+			}
+		}
+	}
+}
+
+// Info returns the configuration and usage of key without creating its limiter
+func (e *AutoLimiter) Info(key string) (KeyInfo, error) {
+	key = e.normalizeKey(key)
+	optsVal, custom := e.options.Load(key)
+	origin := OriginDefault
+	if custom {
+		origin = OriginCustom
+	} else if opts, err := e.ruleOf(key); opts != nil || err != nil {
+		origin = OriginRule
+	}
+	if limiter, err := e.get(key); err == nil {
+		return limiter.info(key, origin), nil
+	}
+	if opts, ok := optsVal.(*internalOptions); ok {
+		return optionsInfo(key, opts.IsUnlimited, opts.MaxCount, opts.Duration, origin), nil
+	}
+	return KeyInfo{}, errkit.Wrapf(ErrKeyMissing, "key: %v", key)
+}
+
 // AddAndTake adds a key with custom settings if not present and then takes a token
 func (e *AutoLimiter) AddAndTake(key string, opts ...AutoLimiterOption) error {
+	key = e.normalizeKey(key)
 	// Check if limiter already exists
-	if limiter, err := e.get(key); err == nil {
-		limiter.Take()
-		return nil
+	if _, err := e.get(key); err == nil {
+		return e.Take(key)
 	}
 
 	// Add the key with custom settings
@@ -261,3 +582,61 @@ func (e *AutoLimiter) AddAndTake(key string, opts ...AutoLimiterOption) error {
 	// Take a token
 	return e.Take(key)
 }
+
+// optionsOf returns the custom options of key or the default ones
+func (e *AutoLimiter) optionsOf(key string) (*internalOptions, error) {
+	if optsVal, exists := e.options.Load(key); exists {
+		if opts, ok := optsVal.(*internalOptions); ok {
+			return opts, nil
+		}
+	}
+	return e.defaultsOf(key)
+}
+
+// defaultsOf returns the options of the first rule matching key or the default ones
+func (e *AutoLimiter) defaultsOf(key string) (*internalOptions, error) {
+	if opts, err := e.ruleOf(key); opts != nil || err != nil {
+		return opts, err
+	}
+	return e.defaults(), nil
+}
+
+// ruleOf returns the options of the first rule matching key or nil,
+// the error of the rule is returned if its options could not be built
+func (e *AutoLimiter) ruleOf(key string) (*internalOptions, error) {
+	e.defaultsMu.RLock()
+	defer e.defaultsMu.RUnlock()
+	for _, r := range e.rules {
+		if r.matcher != nil && r.matcher.Match(key) {
+			return r.options, r.err
+		}
+	}
+	return nil, nil
+}
+
+// defaults returns the current default options
+func (e *AutoLimiter) defaults() *internalOptions {
+	e.defaultsMu.RLock()
+	defer e.defaultsMu.RUnlock()
+	return e.defaultOptions
+}
+
+// normalizeKey applies the normalizer if any
+func (e *AutoLimiter) normalizeKey(key string) string {
+	if e.normalize == nil {
+		return key
+	}
+	return e.normalize(key)
+}
+
+// parentOf returns the keyed parent level of key and the derived parent key
+func (e *AutoLimiter) parentOf(key string) (*AutoLimiter, string) {
+	opts, err := e.optionsOf(key)
+	if err != nil || opts.ParentLimiter == nil {
+		return nil, ""
+	}
+	if opts.ParentKey == nil {
+		return opts.ParentLimiter, key
+	}
+	return opts.ParentLimiter, opts.ParentKey(key)
+}
@@ -3,6 +3,10 @@ package ratelimit
 import (
 	"context"
 	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -170,7 +174,8 @@ func TestAutoLimiterCreateOrDefault(t *testing.T) {
 	limiter := NewAutoLimiter(ctx, WithDuration(time.Second), WithMaxCount(10))
 
 	// Test creating with defaults for new key
-	newLimiter := limiter.createOrDefault("newkey")
+	newLimiter, err := limiter.createOrDefault("newkey")
+	require.NoError(t, err)
 	require.NotNil(t, newLimiter)
 	require.True(t, newLimiter.CanTake())
 
@@ -179,7 +184,8 @@ func TestAutoLimiterCreateOrDefault(t *testing.T) {
 	limiter.Stop("custom")
 
 	// Should recreate with custom options, not defaults
-	recreated := limiter.createOrDefault("custom")
+	recreated, err := limiter.createOrDefault("custom")
+	require.NoError(t, err)
 	require.NotNil(t, recreated)
 
 	// Should be able to take 5 tokens (custom limit), not 10 (default)
@@ -247,3 +253,288 @@ func TestAutoLimiterMemoryEfficiency(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+func TestAutoLimiterParent(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Global Parent", func(t *testing.T) {
+		global := New(ctx, 3, time.Hour)
+		defer global.Stop()
+		limiter := NewAutoLimiter(ctx, WithDuration(time.Hour), WithMaxCount(2), WithParent(global))
+		defer limiter.Stop()
+
+		require.NoError(t, limiter.Take("a"))
+		ok, err := limiter.TryTake("a")
+		require.NoError(t, err)
+		require.True(t, ok)
+		// key "a" is exhausted and must not spend the global budget
+		ok, _ = limiter.TryTake("a")
+		require.False(t, ok)
+		require.True(t, global.CanTake())
+
+		ok, _ = limiter.TryTake("b")
+		require.True(t, ok)
+		// the global budget is exhausted and key "b" keeps its last token
+		require.False(t, limiter.CanTake("b"))
+		ok, _ = limiter.TryTake("b")
+		require.False(t, ok)
+		b, err := limiter.get("b")
+		require.NoError(t, err)
+		require.True(t, b.canTake())
+	})
+
+	t.Run("Multiple Levels", func(t *testing.T) {
+		global := New(ctx, 10, time.Hour)
+		defer global.Stop()
+		orgs := NewAutoLimiter(ctx, WithDuration(time.Hour), WithMaxCount(3), WithParent(global))
+		defer orgs.Stop()
+		orgOf := func(host string) string {
+			return host[strings.Index(host, ".")+1:]
+		}
+		hosts := NewAutoLimiter(ctx, WithDuration(time.Hour), WithMaxCount(2), WithParentKey(orgs, orgOf))
+		defer hosts.Stop()
+
+		for _, host := range []string{"a.org1", "a.org1", "b.org1"} {
+			ok, err := hosts.TryTake(host)
+			require.NoError(t, err)
+			require.True(t, ok, host)
+		}
+		// org1 is exhausted although host c.org1 has budget
+		ok, _ := hosts.TryTake("c.org1")
+		require.False(t, ok)
+		ok, _ = hosts.TryTake("c.org2")
+		require.True(t, ok)
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, hosts.TakeContext(ctx, "d.org1"), context.DeadlineExceeded)
+	})
+
+	t.Run("Custom Key Parent", func(t *testing.T) {
+		global := New(ctx, 1, time.Hour)
+		defer global.Stop()
+		limiter := NewAutoLimiter(ctx, WithDuration(time.Hour), WithMaxCount(2))
+		defer limiter.Stop()
+		require.NoError(t, limiter.Add("custom", WithDuration(time.Hour), WithMaxCount(2), WithParent(global)))
+
+		require.NoError(t, limiter.AddAndTake("custom"))
+		require.False(t, limiter.CanTake("custom"))
+		require.True(t, limiter.CanTake("default"))
+	})
+}
+
+func TestAutoLimiterGetLimit(t *testing.T) {
+	limiter := NewAutoLimiter(context.Background(), WithDuration(time.Second), WithMaxCount(10))
+	defer limiter.Stop()
+	_ = limiter.Add("custom", WithDuration(time.Second), WithMaxCount(5))
+
+	limit, err := limiter.GetLimit("custom")
+	require.NoError(t, err)
+	require.Equal(t, uint(5), limit)
+
+	// keys without a limiter report the default limit
+	limit, err = limiter.GetLimit("unknown")
+	require.NoError(t, err)
+	require.Equal(t, uint(10), limit)
+}
+
+func TestAutoLimiterUpdate(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewAutoLimiter(ctx, WithDuration(time.Hour), WithMaxCount(10))
+	defer limiter.Stop()
+
+	require.ErrorIs(t, limiter.Update("missing", WithDuration(time.Hour), WithMaxCount(1)), ErrKeyMissing)
+
+	// a default key becomes a custom one and the tokens spent count against the lower limit
+	for range 4 {
+		require.NoError(t, limiter.Take("key"))
+	}
+	require.NoError(t, limiter.Update("key", WithDuration(time.Hour), WithMaxCount(5)))
+	limit, err := limiter.GetLimit("key")
+	require.NoError(t, err)
+	require.Equal(t, uint(5), limit)
+	ok, _ := limiter.TryTake("key")
+	require.True(t, ok)
+	ok, _ = limiter.TryTake("key")
+	require.False(t, ok)
+
+	// waiters are preserved and released once the key becomes unlimited
+	done := make(chan error)
+	go func() {
+		done <- limiter.TakeContext(ctx, "key")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, limiter.Update("key", WithUnlimited()))
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not released by the update")
+	}
+
+	// the stored options are used to recreate the limiter
+	require.NoError(t, limiter.Update("key", WithDuration(time.Hour), WithMaxCount(3)))
+	limiter.Stop("key")
+	limit, err = limiter.GetLimit("key")
+	require.NoError(t, err)
+	require.Equal(t, uint(3), limit)
+	require.ErrorIs(t, limiter.Update("key", WithMaxCount(3)), ErrZeroDuration)
+}
+
+func TestAutoLimiterSetDefaults(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Future Keys Only", func(t *testing.T) {
+		limiter := NewAutoLimiter(ctx, WithDuration(time.Hour), WithMaxCount(10))
+		defer limiter.Stop()
+		require.NoError(t, limiter.Take("existing"))
+
+		require.ErrorIs(t, limiter.SetDefaults(WithMaxCount(0)), ErrZeroMaxCount)
+		require.NoError(t, limiter.SetDefaults(WithMaxCount(2)))
+
+		limit, _ := limiter.GetLimit("existing")
+		require.Equal(t, uint(10), limit)
+		require.NoError(t, limiter.Take("new"))
+		limit, _ = limiter.GetLimit("new")
+		require.Equal(t, uint(2), limit)
+		keyLimiter, err := limiter.get("new")
+		require.NoError(t, err)
+		require.Equal(t, time.Hour, keyLimiter.getDuration())
+	})
+
+	t.Run("Propagate To Default Keys", func(t *testing.T) {
+		limiter := NewAutoLimiter(ctx, WithDuration(time.Hour), WithMaxCount(10))
+		defer limiter.Stop()
+		require.NoError(t, limiter.Add("custom", WithDuration(time.Hour), WithMaxCount(5)))
+		for i := 0; i < 3; i++ {
+			require.NoError(t, limiter.Take("default"))
+		}
+
+		require.NoError(t, limiter.SetDefaults(WithMaxCount(4)))
+		require.NoError(t, limiter.PropagateDefaults())
+		limit, _ := limiter.GetLimit("default")
+		require.Equal(t, uint(4), limit)
+		limit, _ = limiter.GetLimit("custom")
+		require.Equal(t, uint(5), limit)
+
+		// the current window keeps the tokens already spent
+		ok, _ := limiter.TryTake("default")
+		require.True(t, ok)
+		ok, _ = limiter.TryTake("default")
+		require.False(t, ok)
+	})
+
+	t.Run("Limiter Options Rejected", func(t *testing.T) {
+		limiter := NewAutoLimiter(ctx, WithDuration(time.Hour), WithMaxCount(10))
+		defer limiter.Stop()
+		require.Error(t, limiter.SetDefaults(WithMaxCount(4), WithNormalizer(NormalizeHost)))
+		require.Error(t, limiter.SetDefaults(WithRules(Rule{Matcher: MatchExact("key")})))
+		require.Error(t, limiter.Add("key", WithDuration(time.Hour), WithMaxCount(4), WithNormalizer(NormalizeHost)))
+		limit, _ := limiter.GetLimit("new")
+		require.Equal(t, uint(10), limit)
+	})
+
+	t.Run("Other Settings Kept", func(t *testing.T) {
+		parent := New(ctx, 1, time.Hour)
+		defer parent.Stop()
+		limiter := NewAutoLimiter(ctx, WithUnlimited(), WithParent(parent), WithMaxQueue(3), WithFIFO())
+		defer limiter.Stop()
+		require.NoError(t, limiter.SetDefaults(WithMaxCount(5), WithDuration(time.Second)))
+
+		require.NoError(t, limiter.Take("new"))
+		keyLimiter, err := limiter.get("new")
+		require.NoError(t, err)
+		require.Same(t, parent, keyLimiter.Parent())
+		require.Equal(t, uint(5), keyLimiter.GetLimit())
+		require.Equal(t, 3, keyLimiter.queue.maxQueue)
+		require.True(t, keyLimiter.queue.fifo)
+		require.Equal(t, time.Second, keyLimiter.getDuration())
+		// the global budget is not bypassed
+		ok, err := limiter.TryTake("other")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		require.NoError(t, limiter.SetDefaults(WithParent(nil)))
+		ok, err = limiter.TryTake("third")
+		require.NoError(t, err)
+		require.True(t, ok)
+		limit, err := limiter.GetLimit("third")
+		require.NoError(t, err)
+		require.Equal(t, uint(5), limit)
+
+		// an unlimited default without a limit option stays unlimited
+		unlimited := NewAutoLimiter(ctx, WithUnlimited())
+		defer unlimited.Stop()
+		require.NoError(t, unlimited.SetDefaults(WithMaxQueue(1)))
+		limit, err = unlimited.GetLimit("key")
+		require.NoError(t, err)
+		require.Equal(t, uint(math.MaxUint32), limit)
+	})
+}
+
+func TestAutoLimiterReservation(t *testing.T) {
+	ctx := context.Background()
+	parent := NewAutoLimiter(ctx, WithMaxCount(1), WithDuration(time.Hour))
+	defer parent.Stop()
+	auto := NewAutoLimiter(ctx, WithMaxCount(1), WithDuration(time.Hour), WithParentKey(parent, nil))
+	defer auto.Stop()
+	reservation, err := auto.Reserve(ctx, "key")
+	require.NoError(t, err)
+	require.False(t, parent.CanTake("key"))
+	reservation.Cancel()
+	require.True(t, auto.CanTake("key"))
+	require.True(t, parent.CanTake("key"))
+
+	reservation, ok, err := auto.TryReserve("key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = auto.TryReserve("key")
+	require.NoError(t, err)
+	require.False(t, ok)
+	reservation.Cancel()
+	require.True(t, parent.CanTake("key"))
+}
+
+func TestAutoLimiterConcurrentCreate(t *testing.T) {
+	auto := NewAutoLimiter(context.Background(), WithMaxCount(10), WithDuration(time.Hour))
+	defer auto.Stop()
+
+	var granted atomic.Int32
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				if ok, _ := auto.TryTake("key"); ok {
+					granted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// the first use of a key creates a single limiter
+	require.Equal(t, int32(10), granted.Load())
+}
+
+func TestAutoLimiterBoundedParentKey(t *testing.T) {
+	ctx := context.Background()
+	parent := NewAutoLimiter(ctx, WithMaxCount(1), WithDuration(time.Hour), WithMaxWait(time.Minute))
+	defer parent.Stop()
+	require.NoError(t, parent.Take("key"))
+	auto := NewAutoLimiter(ctx, WithMaxCount(5), WithDuration(time.Hour), WithParentKey(parent, nil))
+	defer auto.Stop()
+
+	// the token of the key goes back when the parent key fails
+	require.ErrorIs(t, auto.Take("key"), ErrWaitTimeout)
+	require.ErrorIs(t, auto.TakeWithPriority(ctx, "key", PriorityHigh), ErrWaitTimeout)
+	limiter, err := auto.get("key")
+	require.NoError(t, err)
+	require.Equal(t, uint32(5), limiter.count.Load())
+
+	require.NoError(t, parent.Update("key", WithMaxCount(1), WithDuration(time.Hour)))
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, auto.TakeContext(timeout, "key"), context.DeadlineExceeded)
+	require.Equal(t, uint32(5), limiter.count.Load())
+}
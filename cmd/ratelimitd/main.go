@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/projectdiscovery/ratelimit/remote"
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+func main() {
+	var (
+		listen    = flag.String("listen", "127.0.0.1:8080", "address to listen on")
+		mode      = flag.String("mode", "auto", "limiter serving the keys (auto, multi)")
+		maxCount  = flag.Uint("max-count", 10, "default tokens per duration")
+		duration  = flag.Duration("duration", time.Second, "default refill duration")
+		unlimited = flag.Bool("unlimited", false, "don't limit keys by default")
+		key       = flag.String("key", "default", "initial key of the multi limiter")
+	)
+	flag.Parse()
+
+	if err := run(*listen, *mode, *maxCount, *duration, *unlimited, *key); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the limiter until an interrupt, the deferred stops run before main exits
+func run(listen, mode string, maxCount uint, duration time.Duration, unlimited bool, key string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var backend remote.Backend
+	switch mode {
+	case "auto":
+		opts := []ratelimit.AutoLimiterOption{ratelimit.WithMaxCount(maxCount), ratelimit.WithDuration(duration)}
+		if unlimited {
+			opts = append(opts, ratelimit.WithUnlimited())
+		}
+		limiter := ratelimit.NewAutoLimiter(ctx, opts...)
+		defer limiter.Stop()
+		backend = remote.NewAutoLimiterBackend(limiter)
+	case "multi":
+		limiter, err := ratelimit.NewMultiLimiter(ctx, &ratelimit.Options{
+			Key:         key,
+			IsUnlimited: unlimited,
+			MaxCount:    maxCount,
+			Duration:    duration,
+		})
+		if err != nil {
+			return errkit.Wrap(err, "could not create limiter")
+		}
+		defer limiter.Stop()
+		backend = remote.NewMultiLimiterBackend(limiter)
+	default:
+		return errkit.Newf("unknown mode %q", mode)
+	}
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           remote.NewHandler(backend),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("ratelimitd listening on %v", listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errkit.Wrap(err, "could not serve")
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// compositePollInterval is how often limiters other than *Limiter are checked while waiting
+const compositePollInterval = 10 * time.Millisecond
+
+// Composite enforces several limiters at once, i.e., 10/s, 500/min and 10000/day,
+// a token is granted only when all of them can grant one
+type Composite struct {
+	mu       sync.Mutex
+	limiters []RateLimiter
+}
+
+// NewComposite creates a composite limiter from the given limiters, the ones that can't
+// give back a token such as Quota are taken from last so that a refusal doesn't spend them,
+// with more than one of them a refusal of a later one still spends the earlier ones
+func NewComposite(limiters ...RateLimiter) *Composite {
+	ordered := make([]RateLimiter, 0, len(limiters))
+	for _, limiter := range limiters {
+		if _, ok := limiter.(reserver); ok {
+			ordered = append(ordered, limiter)
+		}
+	}
+	for _, limiter := range limiters {
+		if _, ok := limiter.(reserver); !ok {
+			ordered = append(ordered, limiter)
+		}
+	}
+	return &Composite{limiters: ordered}
+}
+
+// Take one token from every limiter, like Limiter.Take it doesn't block anymore
+// once a limiter is stopped without a token left
+func (c *Composite) Take() {
+	_ = c.TakeContext(context.TODO())
+}
+
+// TakeContext takes one token from every limiter or returns the context error
+// if it is done before all of them have a token available, ErrLimiterStopped
+// is returned once a limiter is stopped without a token left
+func (c *Composite) TakeContext(ctx context.Context) error {
+	_, err := c.Reserve(ctx)
+	return err
+}
+
+// Reserve takes one token like TakeContext and returns its reservation, canceling it
+// gives the token back to the limiters that support it
+func (c *Composite) Reserve(ctx context.Context) (*Reservation, error) {
+	for {
+		if reservation, ok := c.TryReserve(); ok {
+			return reservation, nil
+		}
+		// wait outside of the lock until every limiter has a token
+		for _, limiter := range c.limiters {
+			if err := waitFor(ctx, limiter); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// TryTake takes one token from every limiter without waiting and reports whether it succeeded,
+// the tokens already taken are given back to the limiters that support it when one refuses
+func (c *Composite) TryTake() bool {
+	_, ok := c.TryReserve()
+	return ok
+}
+
+// TryReserve takes one token like TryTake and returns its reservation, canceling it
+// gives the token back to the limiters that support it
+func (c *Composite) TryReserve() (*Reservation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.canTake() {
+		return nil, false
+	}
+	reservation := &Reservation{}
+	for _, limiter := range c.limiters {
+		// tokens can still be taken by direct users of the limiters
+		if !tryReserve(limiter, reservation) {
+			reservation.Cancel()
+			return nil, false
+		}
+	}
+	return reservation, true
+}
+
+// CanTake checks if all the limiters have any token
+func (c *Composite) CanTake() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.canTake()
+}
+
+// GetLimit returns the lowest limit of the limiters
+func (c *Composite) GetLimit() uint {
+	var limit uint
+	for i, limiter := range c.limiters {
+		if current := limiter.GetLimit(); i == 0 || current < limit {
+			limit = current
+		}
+	}
+	return limit
+}
+
+// Stop all the limiters
+func (c *Composite) Stop() {
+	for _, limiter := range c.limiters {
+		limiter.Stop()
+	}
+}
+
+func (c *Composite) canTake() bool {
+	for _, limiter := range c.limiters {
+		if !limiter.CanTake() {
+			return false
+		}
+	}
+	return true
+}
+
+// tryReserve takes one token from limiter without waiting adding it to reservation
+// when the limiter can take it back
+func tryReserve(limiter RateLimiter, reservation *Reservation) bool {
+	r, ok := limiter.(reserver)
+	if !ok {
+		return limiter.TryTake()
+	}
+	taken, ok := r.TryReserve()
+	reservation.join(taken)
+	return ok
+}
+
+// waitFor waits until limiter has a token without taking it,
+// it returns ErrLimiterStopped if the limiter was stopped first
+func waitFor(ctx context.Context, limiter RateLimiter) error {
+	if l, ok := limiter.(*Limiter); ok {
+		return l.wait(ctx)
+	}
+	ticker := time.NewTicker(compositePollInterval)
+	defer ticker.Stop()
+	for !limiter.CanTake() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// wait until the limiter and its parents have a token without taking it,
+// it returns ErrLimiterStopped if one of them was stopped first
+func (limiter *Limiter) wait(ctx context.Context) error {
+	for current := limiter; current != nil; current = current.parent.Load() {
+		if err := current.waitAvailable(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitAvailable waits until this bucket has a token without taking it,
+// it returns ErrLimiterStopped if the bucket was stopped first
+func (limiter *Limiter) waitAvailable(ctx context.Context) error {
+	switch limiter.strategy {
+	case LeakyBucket:
+		tokens := limiter.leakyBucketLimiter.Tokens()
+		if tokens >= 1 {
+			return nil
+		}
+		perSecond := float64(limiter.leakyBucketLimiter.Limit())
+		if perSecond <= 0 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		timer := time.NewTimer(time.Duration((1 - tokens) / perSecond * float64(time.Second)))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+	default:
+		for {
+			refilled := *limiter.refilled.Load()
+			if limiter.count.Load() > 0 {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-limiter.done:
+				if limiter.count.Load() > 0 {
+					return nil
+				}
+				return ErrLimiterStopped
+			case <-refilled:
+			}
+		}
+	}
+}
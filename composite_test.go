@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComposite(t *testing.T) {
+	t.Run("All Windows Enforced", func(t *testing.T) {
+		perSecond := New(context.TODO(), 2, time.Second)
+		perHour := New(context.TODO(), 3, time.Hour)
+		composite := NewComposite(perSecond, perHour)
+		defer composite.Stop()
+
+		start := time.Now()
+		composite.Take()
+		composite.Take()
+		require.False(t, composite.CanTake())
+		// the exhausted per second window must not spend the per hour budget
+		require.False(t, composite.TryTake())
+		require.Equal(t, uint32(1), perHour.count.Load())
+
+		// the third token comes with the per second refill
+		require.Nil(t, composite.TakeContext(context.TODO()))
+		require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+
+		// the per hour window is now exhausted
+		require.Eventually(t, perSecond.CanTake, 2*time.Second, 10*time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, composite.TakeContext(ctx), context.DeadlineExceeded)
+		require.True(t, perSecond.CanTake())
+	})
+
+	t.Run("Leaky Bucket Member", func(t *testing.T) {
+		leaky := NewLeakyBucket(context.TODO(), 1, 200*time.Millisecond)
+		perHour := New(context.TODO(), 10, time.Hour)
+		composite := NewComposite(leaky, perHour)
+		defer composite.Stop()
+
+		start := time.Now()
+		composite.Take()
+		composite.Take()
+		require.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+		require.Equal(t, uint32(8), perHour.count.Load())
+	})
+
+	t.Run("Refused Token Given Back", func(t *testing.T) {
+		perHour := New(context.TODO(), 100, time.Hour)
+		leaky := NewLeakyBucket(context.TODO(), 1, 200*time.Millisecond)
+		composite := NewComposite(perHour, leaky)
+		defer composite.Stop()
+
+		granted := 0
+		for range 10 {
+			if composite.TryTake() {
+				granted++
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		require.Equal(t, uint32(100-granted), perHour.count.Load())
+
+		// a member refusing after the check gives the tokens back
+		refusing := NewComposite(perHour, refusingLimiter{})
+		require.False(t, refusing.TryTake())
+		require.Equal(t, uint32(100-granted), perHour.count.Load())
+	})
+
+	t.Run("Quota Taken Last", func(t *testing.T) {
+		quota, err := NewQuota("composite", 5, Monthly)
+		require.NoError(t, err)
+		perHour := New(context.TODO(), 5, time.Hour)
+		composite := NewComposite(quota, perHour, refusingReserver{})
+		defer composite.Stop()
+
+		// the refusal happens before the quota token is spent
+		require.False(t, composite.TryTake())
+		require.Equal(t, uint(5), quota.Remaining())
+		require.Equal(t, uint32(5), perHour.count.Load())
+	})
+}
+
+// refusingReserver is a refusingLimiter that can take back tokens
+type refusingReserver struct {
+	refusingLimiter
+}
+
+func (refusingReserver) Reserve(_ context.Context) (*Reservation, error) { return &Reservation{}, nil }
+func (refusingReserver) TryReserve() (*Reservation, bool)                { return nil, false }
+
+// refusingLimiter claims to have tokens but never grants one
+type refusingLimiter struct{}
+
+func (refusingLimiter) Take()                               {}
+func (refusingLimiter) TakeContext(_ context.Context) error { return nil }
+func (refusingLimiter) TryTake() bool                       { return false }
+func (refusingLimiter) CanTake() bool                       { return true }
+func (refusingLimiter) GetLimit() uint                      { return 1 }
+func (refusingLimiter) Stop()                               {}
+
+func TestCompositeStoppedMember(t *testing.T) {
+	stopped := New(context.TODO(), 1, time.Hour)
+	perHour := New(context.TODO(), 10, time.Hour)
+	defer perHour.Stop()
+	composite := NewComposite(stopped, perHour)
+	composite.Take()
+	stopped.Stop()
+
+	// the stopped member can't grant a token anymore
+	done := make(chan struct{})
+	go func() {
+		composite.Take()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Take blocked on a stopped member")
+	}
+	require.ErrorIs(t, composite.TakeContext(context.TODO()), ErrLimiterStopped)
+	require.Equal(t, uint32(9), perHour.count.Load())
+}
@@ -0,0 +1,302 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/projectdiscovery/utils/errkit"
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes limiters declaratively, it can be loaded from yaml, json or environment variables
+type Config struct {
+	// Global limits all the keys together, it's the limiter built by NewLimiter
+	Global *LimitConfig `yaml:"global,omitempty" json:"global,omitempty"`
+	// Strategy of the global limiter
+	Strategy Strategy `yaml:"strategy,omitempty" json:"strategy,omitempty"`
+	// Defaults apply to the keys not listed in Keys nor matched by Rules
+	Defaults *LimitConfig `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+	// Keys sets the limits of specific keys
+	Keys map[string]LimitConfig `yaml:"keys,omitempty" json:"keys,omitempty"`
+	// Rules set the limits of the keys matching a pattern, only AutoLimiter supports them
+	Rules []RuleConfig `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// LimitConfig is the limit of a key or of a group of keys
+type LimitConfig struct {
+	MaxCount  uint          `yaml:"max_count,omitempty" json:"max_count,omitempty"`
+	Duration  time.Duration `yaml:"duration,omitempty" json:"duration,omitempty"`
+	Unlimited bool          `yaml:"unlimited,omitempty" json:"unlimited,omitempty"`
+}
+
+// RuleConfig is a pattern rule, Type is one of exact, glob, suffix, regex or cidr
+type RuleConfig struct {
+	Type        string `yaml:"type" json:"type"`
+	Pattern     string `yaml:"pattern" json:"pattern"`
+	LimitConfig `yaml:",inline"`
+}
+
+// LoadConfig reads a yaml or json config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errkit.Wrapf(err, "config: could not read %v", path)
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig parses and validates a yaml or json config
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	// json is valid yaml
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, errkit.Wrap(err, "config: could not parse")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ConfigFromEnv reads and validates a config from the environment variables with the given prefix:
+// PREFIX_STRATEGY, PREFIX_GLOBAL_MAX_COUNT, PREFIX_GLOBAL_DURATION, PREFIX_GLOBAL_UNLIMITED,
+// the same for PREFIX_DEFAULTS_*, while PREFIX_KEYS and PREFIX_RULES hold yaml or json
+func ConfigFromEnv(prefix string) (*Config, error) {
+	config := &Config{}
+	if value, ok := os.LookupEnv(prefix + "_STRATEGY"); ok {
+		if err := config.Strategy.UnmarshalText([]byte(value)); err != nil {
+			return nil, errkit.Wrapf(err, "config: %v_STRATEGY", prefix)
+		}
+	}
+	var err error
+	if config.Global, err = limitFromEnv(prefix + "_GLOBAL"); err != nil {
+		return nil, err
+	}
+	if config.Defaults, err = limitFromEnv(prefix + "_DEFAULTS"); err != nil {
+		return nil, err
+	}
+	if value, ok := os.LookupEnv(prefix + "_KEYS"); ok {
+		if err := yaml.Unmarshal([]byte(value), &config.Keys); err != nil {
+			return nil, errkit.Wrapf(err, "config: %v_KEYS", prefix)
+		}
+	}
+	if value, ok := os.LookupEnv(prefix + "_RULES"); ok {
+		if err := yaml.Unmarshal([]byte(value), &config.Rules); err != nil {
+			return nil, errkit.Wrapf(err, "config: %v_RULES", prefix)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// limitFromEnv reads the limit of the variables with the given prefix or nil if none is set
+func limitFromEnv(prefix string) (*LimitConfig, error) {
+	var limit LimitConfig
+	found := false
+	if value, ok := os.LookupEnv(prefix + "_MAX_COUNT"); ok {
+		maxCount, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, errkit.Wrapf(err, "config: %v_MAX_COUNT", prefix)
+		}
+		limit.MaxCount, found = uint(maxCount), true
+	}
+	if value, ok := os.LookupEnv(prefix + "_DURATION"); ok {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, errkit.Wrapf(err, "config: %v_DURATION", prefix)
+		}
+		limit.Duration, found = duration, true
+	}
+	if value, ok := os.LookupEnv(prefix + "_UNLIMITED"); ok {
+		unlimited, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errkit.Wrapf(err, "config: %v_UNLIMITED", prefix)
+		}
+		limit.Unlimited, found = unlimited, true
+	}
+	if !found {
+		return nil, nil
+	}
+	return &limit, nil
+}
+
+// Validate the config, errors name the offending field, i.e., keys.example.com.max_count
+func (c *Config) Validate() error {
+	if c.Global != nil {
+		if err := c.Global.options("").validateLimits(); err != nil {
+			return fieldError("global", err)
+		}
+	}
+	if c.Defaults != nil {
+		if err := c.Defaults.options("").validateLimits(); err != nil {
+			return fieldError("defaults", err)
+		}
+	}
+	for key, limit := range c.Keys {
+		if err := limit.options(key).Validate(); err != nil {
+			return fieldError("keys."+key, err)
+		}
+	}
+	for i, r := range c.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if _, err := r.matcher(); err != nil {
+			return errkit.Wrapf(err, "config: %v", field)
+		}
+		if err := r.options("").validateLimits(); err != nil {
+			return fieldError(field, err)
+		}
+	}
+	return nil
+}
+
+// NewLimiter builds the global limiter, it stops with ctx
+func (c *Config) NewLimiter(ctx context.Context) (*Limiter, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.Global == nil {
+		return nil, errkit.New("config: global limit not set")
+	}
+	return c.globalRate().NewLimiter(ctx)
+}
+
+// globalRate returns the global limit as a rate, MaxCount tokens per Duration with either strategy
+func (c *Config) globalRate() Rate {
+	return Rate{MaxCount: c.Global.MaxCount, Duration: c.Global.Duration, Strategy: c.Strategy, Unlimited: c.Global.Unlimited}
+}
+
+// NewMultiLimiter builds a MultiLimiter with the keys and the defaults,
+// the global limiter if any is the parent of every key
+func (c *Config) NewMultiLimiter(ctx context.Context) (*MultiLimiter, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if len(c.Rules) > 0 {
+		return nil, errkit.New("config: rules are only supported by AutoLimiter")
+	}
+	parent, err := c.parent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	multilimiter := &MultiLimiter{ctx: ctx}
+	if c.Defaults != nil {
+		defaults := c.Defaults.options("")
+		defaults.Parent = parent
+		if err := multilimiter.SetDefaults(defaults); err != nil {
+			return nil, fieldError("defaults", err)
+		}
+	}
+	for key, limit := range c.Keys {
+		opts := limit.options(key)
+		opts.Parent = parent
+		if err := multilimiter.Add(opts); err != nil {
+			return nil, fieldError("keys."+key, err)
+		}
+	}
+	return multilimiter, nil
+}
+
+// NewAutoLimiter builds an AutoLimiter with the keys, the rules and the defaults,
+// the global limiter if any is the parent of every key
+func (c *Config) NewAutoLimiter(ctx context.Context) (*AutoLimiter, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.Defaults == nil {
+		return nil, errkit.New("config: defaults are required by AutoLimiter")
+	}
+	parent, err := c.parent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	autolimiter := NewAutoLimiter(ctx, append(c.Defaults.autoOptions(), WithParent(parent), WithRules(c.autoRules(parent)...))...)
+	for key, limit := range c.Keys {
+		if err := autolimiter.Add(key, append(limit.autoOptions(), WithParent(parent))...); err != nil {
+			return nil, fieldError("keys."+key, err)
+		}
+	}
+	return autolimiter, nil
+}
+
+// autoRules converts the rules to AutoLimiter rules, the config must be valid
+func (c *Config) autoRules(parent *Limiter) []Rule {
+	rules := make([]Rule, 0, len(c.Rules))
+	for _, r := range c.Rules {
+		matcher, _ := r.matcher()
+		rules = append(rules, Rule{Matcher: matcher, Options: append(r.autoOptions(), WithParent(parent))})
+	}
+	return rules
+}
+
+// parent builds the global limiter if any
+func (c *Config) parent(ctx context.Context) (*Limiter, error) {
+	if c.Global == nil {
+		return nil, nil
+	}
+	return c.NewLimiter(ctx)
+}
+
+// options converts the limit to MultiLimiter options
+func (l LimitConfig) options(key string) *Options {
+	return &Options{Key: key, IsUnlimited: l.Unlimited, MaxCount: l.MaxCount, Duration: l.Duration}
+}
+
+// autoOptions converts the limit to AutoLimiter options
+func (l LimitConfig) autoOptions() []AutoLimiterOption {
+	if l.Unlimited {
+		return []AutoLimiterOption{WithUnlimited()}
+	}
+	return []AutoLimiterOption{WithMaxCount(l.MaxCount), WithDuration(l.Duration)}
+}
+
+// matcher builds the matcher of the rule
+func (r RuleConfig) matcher() (Matcher, error) {
+	if r.Pattern == "" {
+		return nil, errkit.New("pattern: empty")
+	}
+	switch r.Type {
+	case "exact":
+		return MatchExact(r.Pattern), nil
+	case "suffix":
+		return MatchSuffix(r.Pattern), nil
+	case "glob":
+		matcher, err := MatchGlob(r.Pattern)
+		if err != nil {
+			return nil, errkit.Wrap(err, "pattern")
+		}
+		return matcher, nil
+	case "regex":
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, errkit.Wrap(err, "pattern")
+		}
+		return MatchRegexp(re), nil
+	case "cidr":
+		prefix, err := netip.ParsePrefix(r.Pattern)
+		if err != nil {
+			return nil, errkit.Wrap(err, "pattern")
+		}
+		return MatchCIDR(prefix), nil
+	default:
+		return nil, errkit.Newf("type: unknown rule type %q", r.Type)
+	}
+}
+
+// fieldError names the field of the validation error
+func fieldError(field string, err error) error {
+	switch {
+	case errors.Is(err, ErrZeroMaxCount):
+		field += ".max_count"
+	case errors.Is(err, ErrZeroDuration):
+		field += ".duration"
+	}
+	return errkit.Wrapf(err, "config: %v", field)
+}
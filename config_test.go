@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+const testYAMLConfig = `
+global:
+  max_count: 100
+  duration: 1s
+defaults:
+  max_count: 10
+  duration: 1s
+keys:
+  scanme.sh:
+    max_count: 1
+    duration: 1m
+rules:
+  - type: suffix
+    pattern: .gov
+    max_count: 2
+    duration: 1s
+  - type: cidr
+    pattern: 10.0.0.0/8
+    unlimited: true
+`
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(testYAMLConfig))
+	require.NoError(t, err)
+	require.Equal(t, &LimitConfig{MaxCount: 100, Duration: time.Second}, config.Global)
+	require.Equal(t, LimitConfig{MaxCount: 1, Duration: time.Minute}, config.Keys["scanme.sh"])
+	require.Len(t, config.Rules, 2)
+	require.True(t, config.Rules[1].Unlimited)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"strategy": "leaky-bucket", "global": {"max_count": 5, "duration": "2s"}}`), 0600))
+	config, err = LoadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, LeakyBucket, config.Strategy)
+	require.Equal(t, 2*time.Second, config.Global.Duration)
+
+	for data, field := range map[string]string{
+		"global: {duration: 1s}":                                "global.max_count",
+		"keys: {scanme.sh: {max_count: 1}}":                     "keys.scanme.sh.duration",
+		"rules: [{type: glob, pattern: '[', unlimited: true}]":  "rules[0]",
+		"rules: [{type: other, pattern: a, unlimited: true}]":   "rules[0]",
+		"rules: [{type: exact, pattern: a, max_count: 1}]":      "rules[0].duration",
+		"defaults: {max_count: 0, duration: 1s, unlimited: no}": "defaults.max_count",
+	} {
+		_, err := ParseConfig([]byte(data))
+		require.ErrorContains(t, err, field, data)
+	}
+	_, err = ParseConfig([]byte("strategy: fastest"))
+	require.ErrorContains(t, err, "fastest")
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("RL_STRATEGY", "none")
+	t.Setenv("RL_GLOBAL_MAX_COUNT", "50")
+	t.Setenv("RL_GLOBAL_DURATION", "1s")
+	t.Setenv("RL_DEFAULTS_UNLIMITED", "true")
+	t.Setenv("RL_KEYS", `{"scanme.sh": {"max_count": 1, "duration": "1m"}}`)
+	t.Setenv("RL_RULES", `[{"type": "glob", "pattern": "*.gov", "max_count": 2, "duration": "1s"}]`)
+
+	config, err := ConfigFromEnv("RL")
+	require.NoError(t, err)
+	require.Equal(t, &LimitConfig{MaxCount: 50, Duration: time.Second}, config.Global)
+	require.Equal(t, &LimitConfig{Unlimited: true}, config.Defaults)
+	require.Equal(t, uint(1), config.Keys["scanme.sh"].MaxCount)
+	require.Equal(t, "*.gov", config.Rules[0].Pattern)
+
+	t.Setenv("RL_GLOBAL_DURATION", "soon")
+	_, err = ConfigFromEnv("RL")
+	require.ErrorContains(t, err, "RL_GLOBAL_DURATION")
+}
+
+func TestConfigBuild(t *testing.T) {
+	ctx := context.Background()
+	config, err := ParseConfig([]byte(testYAMLConfig))
+	require.NoError(t, err)
+
+	limiter, err := config.NewLimiter(ctx)
+	require.NoError(t, err)
+	defer limiter.Stop()
+	require.Equal(t, uint(100), limiter.GetLimit())
+
+	// the leaky bucket spreads the global limit over the duration
+	leakyConfig := *config
+	leakyConfig.Strategy = LeakyBucket
+	leaky, err := leakyConfig.NewLimiter(ctx)
+	require.NoError(t, err)
+	defer leaky.Stop()
+	require.Equal(t, rate.Every(10*time.Millisecond), leaky.leakyBucketLimiter.Limit())
+
+	autolimiter, err := config.NewAutoLimiter(ctx)
+	require.NoError(t, err)
+	defer autolimiter.Stop()
+	for key, expected := range map[string]uint{"scanme.sh": 1, "www.nasa.gov": 2, "example.com": 10} {
+		limit, err := autolimiter.GetLimit(key)
+		require.NoError(t, err)
+		require.Equal(t, expected, limit, key)
+	}
+	info, err := autolimiter.Info("scanme.sh")
+	require.NoError(t, err)
+	require.Equal(t, OriginCustom, info.Origin)
+	opts, err := autolimiter.optionsOf("example.com")
+	require.NoError(t, err)
+	require.NotNil(t, opts.Parent)
+
+	// MultiLimiter has no rules
+	_, err = config.NewMultiLimiter(ctx)
+	require.Error(t, err)
+	config.Rules = nil
+	multilimiter, err := config.NewMultiLimiter(ctx)
+	require.NoError(t, err)
+	defer multilimiter.Stop()
+	limit, err := multilimiter.GetLimit("scanme.sh")
+	require.NoError(t, err)
+	require.Equal(t, uint(1), limit)
+	limit, err = multilimiter.GetLimit("example.com")
+	require.NoError(t, err)
+	require.Equal(t, uint(10), limit)
+
+	config.Defaults = nil
+	_, err = config.NewAutoLimiter(ctx)
+	require.Error(t, err)
+}
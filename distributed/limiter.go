@@ -0,0 +1,201 @@
+package distributed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+var (
+	_ ratelimit.RateLimiter  = (*Limiter)(nil)
+	_ ratelimit.KeyedLimiter = (*MultiLimiter)(nil)
+)
+
+// minRetryAfter bounds the polling of the store while waiting for a token
+const minRetryAfter = time.Millisecond
+
+// Limiter is a single budget shared through a Store
+type Limiter struct {
+	ctx   context.Context
+	store Store
+	key   string
+	limit Limit
+}
+
+// New creates a limiter allowing max tokens of key per duration across all the users of store
+func New(ctx context.Context, store Store, key string, limit Limit) (*Limiter, error) {
+	if key == "" {
+		return nil, ratelimit.ErrEmptyKey
+	}
+	if limit.Max == 0 {
+		return nil, ratelimit.ErrZeroMaxCount
+	}
+	if limit.Duration == 0 {
+		return nil, ratelimit.ErrZeroDuration
+	}
+	return &Limiter{ctx: ctx, store: store, key: key, limit: limit}, nil
+}
+
+// Take one token waiting until it's available
+func (l *Limiter) Take() {
+	_ = l.TakeContext(l.ctx)
+}
+
+// TakeContext takes one token or returns the context error if it is done
+// before a token is available or the store error if any
+func (l *Limiter) TakeContext(ctx context.Context) error {
+	return take(ctx, l.store, l.key, l.limit)
+}
+
+// TryTake takes one token without waiting and reports whether it succeeded
+func (l *Limiter) TryTake() bool {
+	result, err := l.store.Take(l.ctx, l.key, l.limit, 1)
+	return err == nil && result.Allowed
+}
+
+// CanTake checks if the shared budget has any token
+func (l *Limiter) CanTake() bool {
+	result, err := l.store.Take(l.ctx, l.key, l.limit, 0)
+	return err == nil && result.Allowed
+}
+
+// GetLimit returns the tokens allowed per duration
+func (l *Limiter) GetLimit() uint {
+	return l.limit.Max
+}
+
+// Stop is a no-op kept for parity with ratelimit.Limiter, the budget lives in the store
+func (l *Limiter) Stop() {}
+
+// MultiLimiter is the keyed variant of Limiter mirroring ratelimit.MultiLimiter
+type MultiLimiter struct {
+	ctx       context.Context
+	store     Store
+	algorithm Algorithm
+	limits    sync.Map // map of key to *ratelimit.Options
+}
+
+// NewMultiLimiter creates a keyed limiter using algorithm for all the keys
+func NewMultiLimiter(ctx context.Context, store Store, algorithm Algorithm, opts *ratelimit.Options) (*MultiLimiter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	m := &MultiLimiter{ctx: ctx, store: store, algorithm: algorithm}
+	return m, m.Add(opts)
+}
+
+// Add new budget with key
+func (m *MultiLimiter) Add(opts *ratelimit.Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if _, ok := m.limits.LoadOrStore(opts.Key, opts); ok {
+		return errkit.Wrapf(ratelimit.ErrKeyAlreadyExists, "key: %v", opts.Key)
+	}
+	return nil
+}
+
+// GetLimit returns current ratelimit of given key
+func (m *MultiLimiter) GetLimit(key string) (uint, error) {
+	opts, err := m.get(key)
+	if err != nil {
+		return 0, err
+	}
+	return opts.MaxCount, nil
+}
+
+// Take one token from budget returns error if key not present
+func (m *MultiLimiter) Take(key string) error {
+	return m.TakeContext(m.ctx, key)
+}
+
+// TakeContext takes one token from budget or returns error if key not present,
+// the context is done before a token is available or the store fails
+func (m *MultiLimiter) TakeContext(ctx context.Context, key string) error {
+	opts, err := m.get(key)
+	if err != nil {
+		return err
+	}
+	if opts.IsUnlimited {
+		return nil
+	}
+	return take(ctx, m.store, key, m.limitOf(opts))
+}
+
+// TryTake takes one token from budget without waiting and reports whether it succeeded
+func (m *MultiLimiter) TryTake(key string) (bool, error) {
+	opts, err := m.get(key)
+	if err != nil {
+		return false, err
+	}
+	if opts.IsUnlimited {
+		return true, nil
+	}
+	result, err := m.store.Take(m.ctx, key, m.limitOf(opts), 1)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// CanTake checks if the budget with the given key has any token
+func (m *MultiLimiter) CanTake(key string) bool {
+	opts, err := m.get(key)
+	if err != nil {
+		return false
+	}
+	if opts.IsUnlimited {
+		return true
+	}
+	result, err := m.store.Take(m.ctx, key, m.limitOf(opts), 0)
+	return err == nil && result.Allowed
+}
+
+// AddAndTake adds key if not present and then takes token from budget
+func (m *MultiLimiter) AddAndTake(opts *ratelimit.Options) {
+	_ = m.Add(opts)
+	_ = m.Take(opts.Key)
+}
+
+// Stop is a no-op kept for parity with ratelimit.MultiLimiter,
+// the budgets live in the store and don't hold any resource
+func (m *MultiLimiter) Stop(keys ...string) {}
+
+// get returns the options of key
+func (m *MultiLimiter) get(key string) (*ratelimit.Options, error) {
+	val, _ := m.limits.Load(key)
+	if val == nil {
+		return nil, errkit.Wrapf(ratelimit.ErrKeyMissing, "key: %v", key)
+	}
+	if opts, ok := val.(*ratelimit.Options); ok {
+		return opts, nil
+	}
+	return nil, errkit.New("distributed: type assertion of options failed")
+}
+
+func (m *MultiLimiter) limitOf(opts *ratelimit.Options) Limit {
+	return Limit{Algorithm: m.algorithm, Max: opts.MaxCount, Duration: opts.Duration}
+}
+
+// take waits until the store grants a token of key
+func take(ctx context.Context, store Store, key string, limit Limit) error {
+	for {
+		result, err := store.Take(ctx, key, limit, 1)
+		if err != nil {
+			return err
+		}
+		if result.Allowed {
+			return nil
+		}
+		timer := time.NewTimer(max(result.RetryAfter, minRetryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestStore(t)
+	limit := Limit{Algorithm: FixedWindow, Max: 2, Duration: 200 * time.Millisecond}
+
+	// two workers sharing one budget
+	first, err := New(ctx, store, "target", limit)
+	require.Nil(t, err)
+	second, err := New(ctx, store, "target", limit)
+	require.Nil(t, err)
+	require.Equal(t, uint(2), first.GetLimit())
+
+	require.True(t, first.TryTake())
+	require.True(t, second.CanTake())
+	second.Take()
+	require.False(t, first.CanTake())
+	require.False(t, second.TryTake())
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, first.TakeContext(timeout), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.advance(limit.Duration)
+	}()
+	require.Nil(t, first.TakeContext(ctx))
+
+	_, err = New(ctx, store, "", limit)
+	require.ErrorIs(t, err, ratelimit.ErrEmptyKey)
+	_, err = New(ctx, store, "target", Limit{Duration: time.Second})
+	require.ErrorIs(t, err, ratelimit.ErrZeroMaxCount)
+	_, err = New(ctx, store, "target", Limit{Max: 1})
+	require.ErrorIs(t, err, ratelimit.ErrZeroDuration)
+}
+
+func TestMultiLimiter(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+	limiter, err := NewMultiLimiter(ctx, store, SlidingWindow, &ratelimit.Options{
+		Key:      "default",
+		MaxCount: 2,
+		Duration: time.Hour,
+	})
+	require.Nil(t, err)
+	defer limiter.Stop()
+
+	require.Nil(t, limiter.Add(&ratelimit.Options{Key: "unlimited", IsUnlimited: true}))
+	err = limiter.Add(&ratelimit.Options{Key: "default", MaxCount: 1, Duration: time.Hour})
+	require.True(t, errors.Is(err, ratelimit.ErrKeyAlreadyExists))
+
+	limit, err := limiter.GetLimit("default")
+	require.Nil(t, err)
+	require.Equal(t, uint(2), limit)
+
+	require.Nil(t, limiter.Take("default"))
+	ok, err := limiter.TryTake("default")
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.False(t, limiter.CanTake("default"))
+	ok, err = limiter.TryTake("default")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	for i := 0; i < 10; i++ {
+		require.Nil(t, limiter.Take("unlimited"))
+	}
+
+	_, err = limiter.TryTake("missing")
+	require.True(t, errors.Is(err, ratelimit.ErrKeyMissing))
+	require.False(t, limiter.CanTake("missing"))
+
+	limiter.AddAndTake(&ratelimit.Options{Key: "added", MaxCount: 1, Duration: time.Hour})
+	require.False(t, limiter.CanTake("added"))
+}
@@ -0,0 +1,123 @@
+package distributed
+
+import (
+	"context"
+	"time"
+
+	"github.com/projectdiscovery/utils/errkit"
+	"github.com/redis/go-redis/v9"
+)
+
+// fixedWindowScript counts tokens in a key expiring at the end of the window
+var fixedWindowScript = redis.NewScript(`
+local max, window, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	ttl = window
+end
+if count + math.max(n, 1) > max then
+	return {0, max - count, ttl}
+end
+if n > 0 then
+	count = redis.call('INCRBY', KEYS[1], n)
+	if count == n then
+		redis.call('PEXPIRE', KEYS[1], window)
+	end
+end
+return {1, max - count, 0}
+`)
+
+// slidingWindowScript keeps a sorted set of the token timestamps within the window
+var slidingWindowScript = redis.NewScript(`
+local max, window, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count + math.max(n, 1) > max then
+	local retry = window
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	if #oldest > 0 then
+		retry = tonumber(oldest[2]) + window - now
+	end
+	return {0, max - count, retry}
+end
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], now, redis.call('INCR', KEYS[2]))
+end
+if n > 0 then
+	redis.call('PEXPIRE', KEYS[1], window)
+	redis.call('PEXPIRE', KEYS[2], window)
+end
+return {1, max - count - n, 0}
+`)
+
+// gcraScript stores the theoretical arrival time of the next token
+var gcraScript = redis.NewScript(`
+local max, window, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local emission = window / max
+local tat = math.max(tonumber(redis.call('GET', KEYS[1]) or now), now)
+local next_tat = tat + emission * math.max(n, 1)
+local allow_at = next_tat - window
+if now < allow_at then
+	return {0, math.floor((now - (tat - window)) / emission), math.ceil(allow_at - now)}
+end
+if n > 0 then
+	redis.call('SET', KEYS[1], next_tat, 'PX', math.ceil(next_tat - now))
+	tat = next_tat
+end
+return {1, math.floor((now - (tat - window)) / emission), 0}
+`)
+
+// RedisStore is a Store backed by redis lua scripts
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore creates a redis store prefixing all the keys with prefix
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Take n tokens of key, zero only reports whether a token could be taken without taking it
+func (r *RedisStore) Take(ctx context.Context, key string, limit Limit, n uint) (*Result, error) {
+	if limit.Max == 0 || limit.Duration < time.Millisecond {
+		return nil, errkit.New("distributed: invalid limit")
+	}
+	// keep all the keys of a limiter in the same cluster slot
+	redisKey := r.prefix + "{" + key + "}"
+	args := []any{limit.Max, limit.Duration.Milliseconds(), n}
+
+	var script *redis.Script
+	keys := []string{redisKey}
+	switch limit.Algorithm {
+	case FixedWindow:
+		script = fixedWindowScript
+	case SlidingWindow:
+		script = slidingWindowScript
+		keys = append(keys, redisKey+":seq")
+	case GCRA:
+		script = gcraScript
+	default:
+		return nil, errkit.Newf("distributed: unknown algorithm %v", limit.Algorithm)
+	}
+	values, err := script.Run(ctx, r.client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, errkit.Wrap(err, "distributed: redis script failed")
+	}
+	if len(values) != 3 {
+		return nil, errkit.New("distributed: unexpected redis script result")
+	}
+	result := &Result{
+		Allowed:    values[0] == 1,
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}
+	if values[1] > 0 {
+		result.Remaining = uint(values[1])
+	}
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package distributed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer is an in-process redis with a frozen clock
+type testServer struct {
+	*miniredis.Miniredis
+	now time.Time
+}
+
+// advance moves both the clock and the key expiration of the server forward
+func (s *testServer) advance(d time.Duration) {
+	s.now = s.now.Add(d)
+	s.SetTime(s.now)
+	s.FastForward(d)
+}
+
+// newTestStore returns a store backed by a test server
+func newTestStore(t *testing.T) (*RedisStore, *testServer) {
+	server := &testServer{Miniredis: miniredis.RunT(t), now: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	server.SetTime(server.now)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return NewRedisStore(client, "ratelimit:"), server
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+
+	for name, algorithm := range map[string]Algorithm{"FixedWindow": FixedWindow, "SlidingWindow": SlidingWindow, "GCRA": GCRA} {
+		t.Run(name, func(t *testing.T) {
+			store, server := newTestStore(t)
+			limit := Limit{Algorithm: algorithm, Max: 3, Duration: 3 * time.Second}
+
+			for i := 0; i < 3; i++ {
+				result, err := store.Take(ctx, "key", limit, 1)
+				require.Nil(t, err)
+				require.True(t, result.Allowed, "take %d", i)
+				require.Equal(t, uint(2-i), result.Remaining)
+			}
+			result, err := store.Take(ctx, "key", limit, 1)
+			require.Nil(t, err)
+			require.False(t, result.Allowed)
+			require.Greater(t, result.RetryAfter, time.Duration(0))
+			require.LessOrEqual(t, result.RetryAfter, 3*time.Second)
+
+			// peeking doesn't take tokens
+			result, err = store.Take(ctx, "other", limit, 0)
+			require.Nil(t, err)
+			require.True(t, result.Allowed)
+			require.Equal(t, uint(3), result.Remaining)
+
+			server.advance(3 * time.Second)
+			result, err = store.Take(ctx, "key", limit, 1)
+			require.Nil(t, err)
+			require.True(t, result.Allowed)
+		})
+	}
+
+	t.Run("Sliding Window Is Not Reset At Once", func(t *testing.T) {
+		store, server := newTestStore(t)
+		limit := Limit{Algorithm: SlidingWindow, Max: 2, Duration: 2 * time.Second}
+
+		_, err := store.Take(ctx, "key", limit, 1)
+		require.Nil(t, err)
+		server.advance(time.Second)
+		_, err = store.Take(ctx, "key", limit, 1)
+		require.Nil(t, err)
+
+		// only the first token left the window
+		server.advance(1500 * time.Millisecond)
+		result, err := store.Take(ctx, "key", limit, 2)
+		require.Nil(t, err)
+		require.False(t, result.Allowed)
+		require.Equal(t, 500*time.Millisecond, result.RetryAfter)
+		result, err = store.Take(ctx, "key", limit, 1)
+		require.Nil(t, err)
+		require.True(t, result.Allowed)
+	})
+
+	t.Run("GCRA Spaces Tokens", func(t *testing.T) {
+		store, server := newTestStore(t)
+		limit := Limit{Algorithm: GCRA, Max: 2, Duration: 2 * time.Second}
+
+		for i := 0; i < 2; i++ {
+			result, err := store.Take(ctx, "key", limit, 1)
+			require.Nil(t, err)
+			require.True(t, result.Allowed)
+		}
+		result, err := store.Take(ctx, "key", limit, 1)
+		require.Nil(t, err)
+		require.False(t, result.Allowed)
+		require.Equal(t, time.Second, result.RetryAfter)
+
+		// a single token is emitted every second
+		server.advance(time.Second)
+		result, err = store.Take(ctx, "key", limit, 1)
+		require.Nil(t, err)
+		require.True(t, result.Allowed)
+		result, err = store.Take(ctx, "key", limit, 1)
+		require.Nil(t, err)
+		require.False(t, result.Allowed)
+	})
+
+	t.Run("Invalid Limit", func(t *testing.T) {
+		store, _ := newTestStore(t)
+		_, err := store.Take(ctx, "key", Limit{Max: 0, Duration: time.Second}, 1)
+		require.Error(t, err)
+		_, err = store.Take(ctx, "key", Limit{Algorithm: 42, Max: 1, Duration: time.Second}, 1)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,43 @@
+// Package distributed provides rate limiters sharing their state through a Store
+// so that many processes enforce a single budget
+package distributed
+
+import (
+	"context"
+	"time"
+)
+
+// Algorithm is the algorithm used by the store to count tokens
+type Algorithm uint8
+
+const (
+	// FixedWindow allows Max tokens per window starting at the first take
+	FixedWindow Algorithm = iota
+	// SlidingWindow allows Max tokens in any window of the given duration
+	SlidingWindow
+	// GCRA spaces tokens evenly allowing a burst of Max tokens
+	GCRA
+)
+
+// Limit describes the budget of a key
+type Limit struct {
+	Algorithm Algorithm
+	Max       uint
+	Duration  time.Duration
+}
+
+// Result of a take operation
+type Result struct {
+	// Allowed reports whether the tokens were granted
+	Allowed bool
+	// Remaining tokens after the operation
+	Remaining uint
+	// RetryAfter is the time to wait before the tokens can be granted
+	RetryAfter time.Duration
+}
+
+// Store atomically takes tokens from shared budgets
+type Store interface {
+	// Take n tokens of key, zero only reports whether a token could be taken without taking it
+	Take(ctx context.Context, key string, limit Limit, n uint) (*Result, error)
+}
@@ -0,0 +1,30 @@
+package ratelimit
+
+import "github.com/projectdiscovery/utils/errkit"
+
+// errors shared by the keyed limiters and the options checks of the constructors, match them with errors.Is
+var (
+	ErrKeyAlreadyExists = errkit.New("ratelimit: key already exists")
+	ErrKeyMissing       = errkit.New("ratelimit: key does not exist")
+	ErrEmptyKey         = errkit.New("ratelimit: empty keys not allowed")
+	ErrZeroMaxCount     = errkit.New("ratelimit: maxcount cannot be zero")
+	ErrZeroDuration     = errkit.New("ratelimit: time duration not set")
+)
+
+// errors returned to the waiters beyond the limits set with SetMaxQueue and SetMaxWait
+var (
+	ErrQueueFull   = errkit.New("ratelimit: wait queue is full")
+	ErrWaitTimeout = errkit.New("ratelimit: maximum wait exceeded")
+)
+
+// ErrLimiterStopped is returned by Composite when one of its limiters was stopped
+// without a token left and by the filelimit takes after Stop, the stopped limiter
+// can't grant a token anymore
+var ErrLimiterStopped = errkit.New("ratelimit: limiter stopped")
+
+// Deprecated: the AutoLimiter errors are the same as the MultiLimiter ones,
+// use ErrKeyAlreadyExists and ErrKeyMissing instead
+var (
+	ErrAutoKeyAlreadyExists = ErrKeyAlreadyExists
+	ErrAutoKeyMissing       = ErrKeyMissing
+)
@@ -0,0 +1,382 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// FairShareOption is a function that configures the FairShare
+type FairShareOption func(*FairShare)
+
+// WithDefaultWeight sets the weight of the tenants without their own weight, 1 by default
+func WithDefaultWeight(weight float64) FairShareOption {
+	return func(f *FairShare) {
+		f.defaultWeight = weight
+	}
+}
+
+// WithTenantWeight sets the weight of a tenant
+func WithTenantWeight(tenant string, weight float64) FairShareOption {
+	return func(f *FairShare) {
+		f.weights[tenant] = weight
+	}
+}
+
+// WithTenantIdleTimeout sets how long a tenant without waiters is kept, 10 minutes by default,
+// the weights set with WithTenantWeight or SetWeight are kept
+func WithTenantIdleTimeout(timeout time.Duration) FairShareOption {
+	return func(f *FairShare) {
+		f.idleTimeout = timeout
+	}
+}
+
+// FairShare divides the budget of a global limiter among tenants by weight,
+// the share of the tenants not waiting for a token goes to the other ones.
+// Tenants are created on first use like the AutoLimiter keys
+type FairShare struct {
+	global        RateLimiter
+	defaultWeight float64
+	idleTimeout   time.Duration
+	// weights set with WithTenantWeight or SetWeight
+	weights map[string]float64
+
+	mu      sync.Mutex
+	tenants map[string]*tenant
+	// active are the tenants with waiters in round robin order
+	active []*tenant
+	next   int
+
+	wake       chan struct{}
+	done       chan struct{}
+	cancelFunc context.CancelFunc
+	stopOnce   sync.Once
+}
+
+// tenant is the deficit round robin state of a tenant
+type tenant struct {
+	weight   float64
+	deficit  float64
+	credited bool
+	waiters  []*waiter
+	lastUsed time.Time
+}
+
+// NewFairShare creates a fair share of the global limiter, tokens are granted to the
+// waiting tenants by deficit round robin so that each gets a share proportional to its weight
+func NewFairShare(ctx context.Context, global RateLimiter, opts ...FairShareOption) (*FairShare, error) {
+	if global == nil {
+		return nil, errkit.New("fairshare: global limiter not set")
+	}
+	f := &FairShare{
+		global:        global,
+		defaultWeight: 1,
+		idleTimeout:   10 * time.Minute,
+		weights:       make(map[string]float64),
+		tenants:       make(map[string]*tenant),
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if !validWeight(f.defaultWeight) {
+		return nil, errkit.Newf("fairshare: invalid default weight %v", f.defaultWeight)
+	}
+	if f.idleTimeout <= 0 {
+		return nil, ErrZeroDuration
+	}
+	for key, weight := range f.weights {
+		if !validWeight(weight) {
+			return nil, errkit.Newf("fairshare: invalid weight %v of tenant %v", weight, key)
+		}
+	}
+	internalctx, cancel := context.WithCancel(ctx)
+	f.cancelFunc = cancel
+	go f.run(internalctx)
+	return f, nil
+}
+
+// SetWeight sets the weight of a tenant, it applies from its next round
+func (f *FairShare) SetWeight(key string, weight float64) error {
+	if !validWeight(weight) {
+		return errkit.Newf("fairshare: invalid weight %v", weight)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.weights[key] = weight
+	if t, ok := f.tenants[key]; ok {
+		t.weight = weight
+	}
+	return nil
+}
+
+// Take one token for the tenant waiting for its share
+func (f *FairShare) Take(key string) error {
+	return f.TakeContext(context.Background(), key)
+}
+
+// TakeContext takes one token for the tenant or returns the context error
+// if it is done before the tenant is granted one
+func (f *FairShare) TakeContext(ctx context.Context, key string) error {
+	f.mu.Lock()
+	t := f.tenantLocked(key)
+	// nobody is waiting, the budget is not contended
+	if len(f.active) == 0 && f.global.TryTake() {
+		f.mu.Unlock()
+		return nil
+	}
+	w := &waiter{ready: make(chan struct{})}
+	t.waiters = append(t.waiters, w)
+	if len(t.waiters) == 1 {
+		f.active = append(f.active, t)
+	}
+	f.mu.Unlock()
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		if f.cancelWait(t, w) {
+			return ctx.Err()
+		}
+		// the token was granted in the meantime
+		return nil
+	case <-f.done:
+		// a stopped fair share doesn't block anymore
+		f.cancelWait(t, w)
+		return nil
+	}
+}
+
+// TryTake takes one token for the tenant if nobody is waiting and reports whether it succeeded
+func (f *FairShare) TryTake(key string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tenantLocked(key)
+	if len(f.active) > 0 {
+		return false, nil
+	}
+	return f.global.TryTake(), nil
+}
+
+// CanTake checks if the tenant would get a token without waiting
+func (f *FairShare) CanTake(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.active) == 0 && f.global.CanTake()
+}
+
+// GetLimit returns the share of the global limit of the tenant among the tenants
+// waiting for a token, the whole limit when nobody else is waiting
+func (f *FairShare) GetLimit(key string) (uint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	weight := f.weightLocked(key)
+	total := weight
+	for _, t := range f.active {
+		if t != f.tenants[key] {
+			total += t.weight
+		}
+	}
+	return max(1, uint(float64(f.global.GetLimit())*weight/total)), nil
+}
+
+// Stop the tenants with the given keys or the fair share if none is given, the waiters
+// of the stopped tenants don't block anymore and their weights are dropped,
+// the global limiter is not stopped
+func (f *FairShare) Stop(keys ...string) {
+	if len(keys) == 0 {
+		f.stopOnce.Do(func() {
+			f.cancelFunc()
+			close(f.done)
+		})
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		delete(f.weights, key)
+		t, ok := f.tenants[key]
+		if !ok {
+			continue
+		}
+		for _, w := range t.waiters {
+			close(w.ready)
+		}
+		t.waiters = nil
+		f.deactivateLocked(t)
+		delete(f.tenants, key)
+	}
+}
+
+// Len returns the number of known tenants
+func (f *FairShare) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.tenants)
+}
+
+// fairShareMinRetry and fairShareMaxRetry bound the backoff of the dispatcher when the global limiter fails
+const (
+	fairShareMinRetry = time.Millisecond
+	fairShareMaxRetry = time.Second
+)
+
+func (f *FairShare) run(ctx context.Context) {
+	ticker := time.NewTicker(f.idleTimeout)
+	defer ticker.Stop()
+	var backoff time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.expire()
+		case <-f.wake:
+		}
+		for f.waiting() {
+			reservation, err := f.reserveGlobal(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				// a bounded or remote global limiter failed, the waiters keep waiting
+				backoff = min(max(2*backoff, fairShareMinRetry), fairShareMaxRetry)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				continue
+			}
+			backoff = 0
+			f.mu.Lock()
+			if !f.grantLocked() {
+				// the waiters canceled in the meantime
+				reservation.Cancel()
+			}
+			f.mu.Unlock()
+			select {
+			case <-ticker.C:
+				f.expire()
+			default:
+			}
+		}
+	}
+}
+
+// reserveGlobal takes one token from the global limiter, the reservation is nil
+// when the global limiter can't take it back
+func (f *FairShare) reserveGlobal(ctx context.Context) (*Reservation, error) {
+	if r, ok := f.global.(reserver); ok {
+		return r.Reserve(ctx)
+	}
+	return nil, f.global.TakeContext(ctx)
+}
+
+// expire forgets the tenants without waiters idle for longer than the idle timeout
+func (f *FairShare) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, t := range f.tenants {
+		if len(t.waiters) == 0 && time.Since(t.lastUsed) > f.idleTimeout {
+			delete(f.tenants, key)
+		}
+	}
+}
+
+// waiting reports whether any tenant waits for a token
+func (f *FairShare) waiting() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.active) > 0
+}
+
+// grantLocked grants one token by deficit round robin and reports whether
+// a tenant was waiting for it, f.mu must be held
+func (f *FairShare) grantLocked() bool {
+	for len(f.active) > 0 {
+		f.next %= len(f.active)
+		t := f.active[f.next]
+		// each round credits the weight of the tenant once
+		if !t.credited {
+			t.deficit += t.weight
+			t.credited = true
+		}
+		if t.deficit >= 1 {
+			t.deficit--
+			w := t.waiters[0]
+			t.waiters = t.waiters[1:]
+			close(w.ready)
+			if len(t.waiters) == 0 {
+				f.deactivateLocked(t)
+			}
+			return true
+		}
+		t.credited = false
+		f.next++
+	}
+	return false
+}
+
+// cancelWait removes the waiter and reports whether it was still waiting
+func (f *FairShare) cancelWait(t *tenant, w *waiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, current := range t.waiters {
+		if current == w {
+			t.waiters = append(t.waiters[:i], t.waiters[i+1:]...)
+			if len(t.waiters) == 0 {
+				f.deactivateLocked(t)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// deactivateLocked removes the tenant from the round robin, an idle tenant doesn't keep its deficit
+func (f *FairShare) deactivateLocked(t *tenant) {
+	t.deficit, t.credited = 0, false
+	for i, current := range f.active {
+		if current == t {
+			f.active = append(f.active[:i], f.active[i+1:]...)
+			if i < f.next {
+				f.next--
+			}
+			return
+		}
+	}
+}
+
+// tenantLocked returns the tenant of key creating it if needed, f.mu must be held
+func (f *FairShare) tenantLocked(key string) *tenant {
+	t, ok := f.tenants[key]
+	if !ok {
+		t = &tenant{weight: f.weightLocked(key)}
+		f.tenants[key] = t
+	}
+	t.lastUsed = time.Now()
+	return t
+}
+
+// weightLocked returns the weight of key, f.mu must be held
+func (f *FairShare) weightLocked(key string) float64 {
+	if weight, ok := f.weights[key]; ok {
+		return weight
+	}
+	return f.defaultWeight
+}
+
+// validWeight checks that the weight is positive and finite
+func validWeight(weight float64) bool {
+	return weight > 0 && !math.IsInf(weight, 0) && !math.IsNaN(weight)
+}
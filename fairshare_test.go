@@ -0,0 +1,228 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fairWaiting waits until n callers wait for a token of the fair share
+func fairWaiting(t *testing.T, f *FairShare, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		count := 0
+		for _, tenant := range f.active {
+			count += len(tenant.waiters)
+		}
+		return count == n
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestFairShare(t *testing.T) {
+	ctx := context.Background()
+	global := New(ctx, 1, time.Hour)
+	defer global.Stop()
+	fair, err := NewFairShare(ctx, global, WithTenantWeight("b", 3))
+	require.NoError(t, err)
+	defer fair.Stop()
+
+	// the budget is not contended
+	ok, err := fair.TryTake("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, fair.CanTake("a"))
+
+	granted := make(chan string, 20)
+	for _, key := range []string{"a", "b"} {
+		for range 10 {
+			go func() {
+				require.NoError(t, fair.Take(key))
+				granted <- key
+			}()
+		}
+	}
+	fairWaiting(t, fair, 20)
+	// a tenant that is waiting can't skip the queue
+	ok, err = fair.TryTake("c")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	counts := map[string]int{}
+	for range 8 {
+		global.refill(1)
+		counts[<-granted]++
+	}
+	require.Equal(t, map[string]int{"a": 2, "b": 6}, counts)
+
+	for range 4 {
+		global.refill(1)
+		counts[<-granted]++
+	}
+	require.Equal(t, map[string]int{"a": 3, "b": 9}, counts)
+	for range 2 {
+		global.refill(1)
+		counts[<-granted]++
+	}
+	require.Equal(t, map[string]int{"a": 4, "b": 10}, counts)
+	// the share of the idle tenants goes to the waiting ones
+	for range 6 {
+		global.refill(1)
+		require.Equal(t, "a", <-granted)
+	}
+
+	limit, err := fair.GetLimit("b")
+	require.NoError(t, err)
+	require.Equal(t, uint(1), limit)
+	require.Equal(t, 3, fair.Len())
+}
+
+func TestFairShareWeights(t *testing.T) {
+	ctx := context.Background()
+	global := New(ctx, 8, time.Hour)
+	defer global.Stop()
+	_, err := NewFairShare(ctx, global, WithDefaultWeight(0))
+	require.Error(t, err)
+	fair, err := NewFairShare(ctx, global, WithDefaultWeight(2))
+	require.NoError(t, err)
+	defer fair.Stop()
+	require.Error(t, fair.SetWeight("a", -1))
+	require.NoError(t, fair.SetWeight("a", 6))
+
+	// nobody else is waiting
+	limit, err := fair.GetLimit("b")
+	require.NoError(t, err)
+	require.Equal(t, uint(8), limit)
+
+	for range 8 {
+		require.NoError(t, fair.Take("b"))
+	}
+	done := make(chan error)
+	go func() {
+		done <- fair.Take("a")
+	}()
+	fairWaiting(t, fair, 1)
+	limit, err = fair.GetLimit("a")
+	require.NoError(t, err)
+	require.Equal(t, uint(8), limit)
+	limit, err = fair.GetLimit("b")
+	require.NoError(t, err)
+	require.Equal(t, uint(2), limit)
+	global.refill(1)
+	require.NoError(t, <-done)
+}
+
+func TestFairShareIdleTenants(t *testing.T) {
+	ctx := context.Background()
+	global := New(ctx, 1, time.Hour)
+	defer global.Stop()
+	_, err := NewFairShare(ctx, global, WithTenantIdleTimeout(0))
+	require.Error(t, err)
+	fair, err := NewFairShare(ctx, global, WithTenantIdleTimeout(10*time.Millisecond), WithTenantWeight("a", 3))
+	require.NoError(t, err)
+	defer fair.Stop()
+	for _, key := range []string{"a", "b"} {
+		_, err := fair.TryTake(key)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, fair.Len())
+	require.Eventually(t, func() bool {
+		return fair.Len() == 0
+	}, 5*time.Second, time.Millisecond)
+	// the configured weights are kept
+	fair.mu.Lock()
+	require.Equal(t, 3.0, fair.tenantLocked("a").weight)
+	fair.mu.Unlock()
+	fair.Stop("a")
+	fair.mu.Lock()
+	require.Equal(t, 1.0, fair.weightLocked("a"))
+	fair.mu.Unlock()
+}
+
+func TestFairShareCanceledWaiters(t *testing.T) {
+	ctx := context.Background()
+	global := New(ctx, 1, time.Hour)
+	defer global.Stop()
+	fair, err := NewFairShare(ctx, global)
+	require.NoError(t, err)
+	defer fair.Stop()
+	require.NoError(t, fair.Take("a"))
+
+	timeout, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- fair.TakeContext(timeout, "a")
+	}()
+	fairWaiting(t, fair, 1)
+	// the waiter leaves once the token for it is taken from the global limiter
+	fair.mu.Lock()
+	global.refill(1)
+	require.Eventually(t, func() bool {
+		return global.count.Load() == 0
+	}, 5*time.Second, time.Millisecond)
+	tenant := fair.tenants["a"]
+	tenant.waiters = nil
+	fair.deactivateLocked(tenant)
+	fair.mu.Unlock()
+	// and the token goes back to the global limiter
+	require.Eventually(t, func() bool {
+		return global.count.Load() == 1
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestFairShareStop(t *testing.T) {
+	ctx := context.Background()
+	global := New(ctx, 1, time.Hour)
+	defer global.Stop()
+	fair, err := NewFairShare(ctx, global)
+	require.NoError(t, err)
+	require.NoError(t, fair.Take("a"))
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, fair.TakeContext(timeout, "a"), context.DeadlineExceeded)
+	fairWaiting(t, fair, 0)
+
+	done := make(chan error, 2)
+	for _, key := range []string{"a", "b"} {
+		go func() {
+			done <- fair.Take(key)
+		}()
+	}
+	fairWaiting(t, fair, 2)
+	fair.Stop("a")
+	require.NoError(t, <-done)
+	fair.Stop()
+	require.NoError(t, <-done)
+}
+
+func TestFairShareGlobalErrors(t *testing.T) {
+	ctx := context.Background()
+	global := New(ctx, 1, time.Hour)
+	defer global.Stop()
+	global.SetMaxWait(time.Millisecond)
+	fair, err := NewFairShare(ctx, global)
+	require.NoError(t, err)
+	defer fair.Stop()
+	require.NoError(t, fair.Take("a"))
+
+	done := make(chan error)
+	go func() {
+		done <- fair.Take("a")
+	}()
+	fairWaiting(t, fair, 1)
+	// the global limiter fails with ErrWaitTimeout in the meantime
+	time.Sleep(20 * time.Millisecond)
+	global.refill(1)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter not served after the global refill")
+	}
+}
@@ -0,0 +1,223 @@
+// Package filelimit provides a rate limiter whose state lives in a file
+// so that several processes on the same host share one budget per key
+package filelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+var _ ratelimit.RateLimiter = (*Limiter)(nil)
+
+// state is the content of the state file
+type state struct {
+	WindowStart time.Time `json:"window_start"`
+	Count       uint      `json:"count"`
+}
+
+// Limiter allows a burst of max tokens per duration shared by all the processes using the same file
+type Limiter struct {
+	ctx      context.Context
+	path     string
+	lockPath string
+	maxCount uint
+	duration time.Duration
+	lockFile *os.File
+	// mu serializes the goroutines of this process, flock only excludes other open files
+	mu      sync.Mutex
+	nowFunc func() time.Time
+	// stopped is closed and closed set under mu once the lock file is released
+	stopped chan struct{}
+	closed  bool
+}
+
+// New creates a limiter for key keeping its state in dir
+func New(ctx context.Context, dir, key string, max uint, duration time.Duration) (*Limiter, error) {
+	if key == "" {
+		return nil, ratelimit.ErrEmptyKey
+	}
+	if max == 0 {
+		return nil, ratelimit.ErrZeroMaxCount
+	}
+	if duration == 0 {
+		return nil, ratelimit.ErrZeroDuration
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	name := sanitize(key)
+	limiter := &Limiter{
+		ctx:      ctx,
+		path:     filepath.Join(dir, name+".json"),
+		lockPath: filepath.Join(dir, name+".lock"),
+		maxCount: max,
+		duration: duration,
+		nowFunc:  time.Now,
+		stopped:  make(chan struct{}),
+	}
+	lockFile, err := os.OpenFile(limiter.lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	limiter.lockFile = lockFile
+	return limiter, nil
+}
+
+// Take one token from the shared bucket
+func (limiter *Limiter) Take() {
+	_ = limiter.TakeContext(limiter.ctx)
+}
+
+// TakeContext takes one token from the shared bucket or returns the context error
+// if it is done before a token is available, ratelimit.ErrLimiterStopped once
+// the limiter is stopped or the state file error if any
+func (limiter *Limiter) TakeContext(ctx context.Context) error {
+	for {
+		ok, windowEnd, err := limiter.update(true)
+		if err != nil || ok {
+			return err
+		}
+		timer := time.NewTimer(time.Until(windowEnd))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-limiter.stopped:
+			timer.Stop()
+			return ratelimit.ErrLimiterStopped
+		case <-timer.C:
+		}
+	}
+}
+
+// TryTake takes one token without waiting and reports whether it succeeded
+func (limiter *Limiter) TryTake() bool {
+	ok, _, err := limiter.update(true)
+	return err == nil && ok
+}
+
+// CanTake checks if the shared bucket has any token
+func (limiter *Limiter) CanTake() bool {
+	ok, _, err := limiter.update(false)
+	return err == nil && ok
+}
+
+// GetLimit returns current rate limit per given duration
+func (limiter *Limiter) GetLimit() uint {
+	return limiter.maxCount
+}
+
+// Stop the limiter releasing the lock file, the takes fail from now on
+func (limiter *Limiter) Stop() {
+	// the lock file can't be closed while update uses it
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if limiter.closed {
+		return
+	}
+	limiter.closed = true
+	close(limiter.stopped)
+	_ = limiter.lockFile.Close()
+}
+
+// update checks and optionally takes a token under the file lock,
+// it returns whether a token is available and when the current window ends
+func (limiter *Limiter) update(take bool) (bool, time.Time, error) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if limiter.closed {
+		return false, time.Time{}, ratelimit.ErrLimiterStopped
+	}
+	if err := lock(limiter.lockFile); err != nil {
+		return false, time.Time{}, errkit.Wrap(err, "filelimit: could not lock state")
+	}
+	defer func() {
+		_ = unlock(limiter.lockFile)
+	}()
+
+	now := limiter.nowFunc()
+	current := limiter.read()
+	// windows are aligned to the first one so every process sees the same boundaries
+	if current.WindowStart.IsZero() || current.WindowStart.After(now) {
+		current = state{WindowStart: now}
+	} else if elapsed := now.Sub(current.WindowStart); elapsed >= limiter.duration {
+		current = state{WindowStart: current.WindowStart.Add(elapsed - elapsed%limiter.duration)}
+	}
+	windowEnd := current.WindowStart.Add(limiter.duration)
+	if current.Count >= limiter.maxCount {
+		return false, windowEnd, nil
+	}
+	if !take {
+		return true, windowEnd, nil
+	}
+	current.Count++
+	if err := limiter.write(current); err != nil {
+		return false, windowEnd, err
+	}
+	return true, windowEnd, nil
+}
+
+// read the state file, a missing or corrupted file starts a new window
+func (limiter *Limiter) read() state {
+	var current state
+	data, err := os.ReadFile(limiter.path)
+	if err != nil {
+		return state{}
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		return state{}
+	}
+	return current
+}
+
+// write the state file atomically so a crash never leaves a partial file behind
+func (limiter *Limiter) write(current state) error {
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(limiter.path), filepath.Base(limiter.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, limiter.path)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(tmp))
+	}
+	return nil
+}
+
+// sanitize turns a key into a safe file name, the other characters are escaped
+// as _xx so that different keys never share a file
+func sanitize(key string) string {
+	var name strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9', b == '-', b == '.':
+			name.WriteByte(b)
+		default:
+			fmt.Fprintf(&name, "_%02x", b)
+		}
+	}
+	return name.String()
+}
@@ -0,0 +1,219 @@
+//go:build linux
+
+package filelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperProcess takes tokens from another process when invoked by the tests
+func TestHelperProcess(t *testing.T) {
+	dir := os.Getenv("FILELIMIT_HELPER_DIR")
+	if dir == "" {
+		return
+	}
+	limiter, err := New(context.Background(), dir, "shared", 10, time.Hour)
+	if err != nil {
+		os.Exit(2)
+	}
+	if os.Getenv("FILELIMIT_HELPER_HOLD") != "" {
+		// simulate a crash while holding the lock
+		_ = lock(limiter.lockFile)
+		fmt.Println("locked")
+		time.Sleep(time.Hour)
+	}
+	taken := 0
+	for limiter.TryTake() {
+		taken++
+	}
+	fmt.Print(taken)
+	os.Exit(0)
+}
+
+func helper(t *testing.T, dir string, env ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), append(env, "FILELIMIT_HELPER_DIR="+dir)...)
+	return cmd
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("Shared Budget", func(t *testing.T) {
+		dir := t.TempDir()
+		first, err := New(context.Background(), dir, "shared", 10, time.Hour)
+		require.Nil(t, err)
+		defer first.Stop()
+		second, err := New(context.Background(), dir, "shared", 10, time.Hour)
+		require.Nil(t, err)
+		defer second.Stop()
+
+		var taken atomic.Int32
+		var wg sync.WaitGroup
+		for _, limiter := range []*Limiter{first, second} {
+			wg.Add(1)
+			go func(limiter *Limiter) {
+				defer wg.Done()
+				for limiter.TryTake() {
+					taken.Add(1)
+				}
+			}(limiter)
+		}
+		wg.Wait()
+		require.Equal(t, int32(10), taken.Load())
+		require.False(t, first.CanTake())
+
+		other, err := New(context.Background(), dir, "other key", 10, time.Hour)
+		require.Nil(t, err)
+		defer other.Stop()
+		require.True(t, other.CanTake())
+	})
+
+	t.Run("Shared Between Goroutines", func(t *testing.T) {
+		dir := t.TempDir()
+		limiter, err := New(context.Background(), dir, "shared", 100, time.Hour)
+		require.Nil(t, err)
+		defer limiter.Stop()
+
+		var taken atomic.Int32
+		var wg sync.WaitGroup
+		for range 16 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for limiter.TryTake() {
+					taken.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, int32(100), taken.Load())
+		// no temporary file is left behind
+		entries, err := os.ReadDir(dir)
+		require.Nil(t, err)
+		require.Len(t, entries, 2)
+	})
+
+	t.Run("Distinct Keys", func(t *testing.T) {
+		dir := t.TempDir()
+		slash, err := New(context.Background(), dir, "a/b", 1, time.Hour)
+		require.Nil(t, err)
+		defer slash.Stop()
+		underscore, err := New(context.Background(), dir, "a_b", 1, time.Hour)
+		require.Nil(t, err)
+		defer underscore.Stop()
+		require.True(t, slash.TryTake())
+		require.True(t, underscore.TryTake())
+	})
+
+	t.Run("Shared Across Processes", func(t *testing.T) {
+		dir := t.TempDir()
+		limiter, err := New(context.Background(), dir, "shared", 10, time.Hour)
+		require.Nil(t, err)
+		defer limiter.Stop()
+		for i := 0; i < 4; i++ {
+			require.True(t, limiter.TryTake())
+		}
+
+		output, err := helper(t, dir).Output()
+		require.Nil(t, err)
+		taken, err := strconv.Atoi(strings.TrimSpace(string(output)))
+		require.Nil(t, err)
+		require.Equal(t, 6, taken)
+		require.False(t, limiter.TryTake())
+	})
+
+	t.Run("Crashed Process Releases Lock", func(t *testing.T) {
+		dir := t.TempDir()
+		cmd := helper(t, dir, "FILELIMIT_HELPER_HOLD=1")
+		stdout, err := cmd.StdoutPipe()
+		require.Nil(t, err)
+		require.Nil(t, cmd.Start())
+		buf := make([]byte, len("locked"))
+		_, err = stdout.Read(buf)
+		require.Nil(t, err)
+		require.Nil(t, cmd.Process.Kill())
+		_ = cmd.Wait()
+
+		limiter, err := New(context.Background(), dir, "shared", 10, time.Hour)
+		require.Nil(t, err)
+		defer limiter.Stop()
+		require.True(t, limiter.TryTake())
+	})
+
+	t.Run("Window Refill", func(t *testing.T) {
+		limiter, err := New(context.Background(), t.TempDir(), "refill", 2, 200*time.Millisecond)
+		require.Nil(t, err)
+		defer limiter.Stop()
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			require.Nil(t, limiter.TakeContext(context.Background()))
+		}
+		require.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+		require.True(t, limiter.TryTake())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, limiter.TakeContext(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("Corrupted State", func(t *testing.T) {
+		dir := t.TempDir()
+		require.Nil(t, os.WriteFile(filepath.Join(dir, "corrupted.json"), []byte("{\"window_sta"), 0o644))
+		limiter, err := New(context.Background(), dir, "corrupted", 1, time.Hour)
+		require.Nil(t, err)
+		defer limiter.Stop()
+		require.True(t, limiter.TryTake())
+		require.False(t, limiter.TryTake())
+	})
+
+	t.Run("Stopped", func(t *testing.T) {
+		limiter, err := New(context.Background(), t.TempDir(), "stopped", 1, time.Hour)
+		require.Nil(t, err)
+		require.True(t, limiter.TryTake())
+
+		// the waiters and the concurrent takes fail once the lock file is closed
+		done := make(chan error)
+		go func() {
+			done <- limiter.TakeContext(context.Background())
+		}()
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 100 {
+					limiter.TryTake()
+				}
+			}()
+		}
+		limiter.Stop()
+		wg.Wait()
+		require.ErrorIs(t, <-done, ratelimit.ErrLimiterStopped)
+		require.False(t, limiter.TryTake())
+		require.False(t, limiter.CanTake())
+		require.ErrorIs(t, limiter.TakeContext(context.Background()), ratelimit.ErrLimiterStopped)
+		limiter.Stop()
+	})
+
+	t.Run("Invalid Options", func(t *testing.T) {
+		_, err := New(context.Background(), t.TempDir(), "", 1, time.Second)
+		require.ErrorIs(t, err, ratelimit.ErrEmptyKey)
+		_, err = New(context.Background(), t.TempDir(), "key", 0, time.Second)
+		require.ErrorIs(t, err, ratelimit.ErrZeroMaxCount)
+		_, err = New(context.Background(), t.TempDir(), "key", 1, 0)
+		require.ErrorIs(t, err, ratelimit.ErrZeroDuration)
+	})
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package filelimit
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive lock on file, the kernel releases it
+// if the owning process dies so a crash never leaves a stale lock
+func lock(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// unlock releases the lock on file
+func unlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
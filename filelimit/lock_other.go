@@ -0,0 +1,20 @@
+//go:build !linux
+
+package filelimit
+
+import (
+	"os"
+
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// errUnsupported is returned on platforms without flock support
+var errUnsupported = errkit.New("filelimit: file locking is only supported on linux")
+
+func lock(file *os.File) error {
+	return errUnsupported
+}
+
+func unlock(file *os.File) error {
+	return errUnsupported
+}
@@ -0,0 +1,183 @@
+// Package grpclimit provides grpc client and server interceptors
+// taking tokens from keyed rate limiters
+package grpclimit
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/projectdiscovery/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// CallInfo describes the call being rate limited
+type CallInfo struct {
+	// FullMethod is the full rpc method string, i.e., /package.service/method
+	FullMethod string
+	// Target is the dial target of client calls, empty on the server side
+	Target string
+}
+
+// KeyFunc returns the limiter key of a call
+type KeyFunc func(ctx context.Context, info CallInfo) string
+
+// ByMethod keys calls by full method name
+func ByMethod() KeyFunc {
+	return func(ctx context.Context, info CallInfo) string {
+		return info.FullMethod
+	}
+}
+
+// ByPeer keys calls by remote address host on the server side and by dial target on the client side
+func ByPeer() KeyFunc {
+	return func(ctx context.Context, info CallInfo) string {
+		if info.Target != "" {
+			return info.Target
+		}
+		p, ok := peer.FromContext(ctx)
+		if !ok || p.Addr == nil {
+			return ""
+		}
+		address := p.Addr.String()
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			return host
+		}
+		return address
+	}
+}
+
+// ByMetadata keys calls by the first value of the given metadata entry
+func ByMetadata(name string) KeyFunc {
+	return func(ctx context.Context, info CallInfo) string {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if info.Target != "" {
+			md, ok = metadata.FromOutgoingContext(ctx)
+		}
+		if !ok {
+			return ""
+		}
+		if values := md.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+}
+
+// Option is a function that configures the interceptors
+type Option func(*options)
+
+type options struct {
+	keyFunc KeyFunc
+	wait    bool
+}
+
+// WithKeyFunc sets how the limiter key is derived from a call, default is ByMethod
+func WithKeyFunc(keyFunc KeyFunc) Option {
+	return func(o *options) {
+		o.keyFunc = keyFunc
+	}
+}
+
+// WithWait makes server interceptors wait for a token instead of rejecting the call
+func WithWait() Option {
+	return func(o *options) {
+		o.wait = true
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{keyFunc: ByMethod()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// UnaryServerInterceptor rejects calls exceeding the rate limit with codes.ResourceExhausted
+func UnaryServerInterceptor(limiter ratelimit.KeyedLimiter, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := o.serverTake(ctx, limiter, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streams exceeding the rate limit with codes.ResourceExhausted
+func StreamServerInterceptor(limiter ratelimit.KeyedLimiter, opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := o.serverTake(ss.Context(), limiter, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// UnaryClientInterceptor waits for a token before sending each call
+func UnaryClientInterceptor(limiter ratelimit.KeyedLimiter, opts ...Option) grpc.UnaryClientInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		if err := o.clientTake(ctx, limiter, method, cc.Target()); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, callOpts...)
+	}
+}
+
+// StreamClientInterceptor waits for a token before opening each stream
+func StreamClientInterceptor(limiter ratelimit.KeyedLimiter, opts ...Option) grpc.StreamClientInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := o.clientTake(ctx, limiter, method, cc.Target()); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, callOpts...)
+	}
+}
+
+// serverTake takes a token for an incoming call
+func (o *options) serverTake(ctx context.Context, limiter ratelimit.KeyedLimiter, method string) error {
+	key := o.keyFunc(ctx, CallInfo{FullMethod: method})
+	if o.wait {
+		if err := limiter.TakeContext(ctx, key); err != nil {
+			return toStatus(err)
+		}
+		return nil
+	}
+	ok, err := limiter.TryTake(key)
+	if err != nil {
+		return toStatus(err)
+	}
+	if !ok {
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %q", key)
+	}
+	return nil
+}
+
+// clientTake waits for a token for an outgoing call
+func (o *options) clientTake(ctx context.Context, limiter ratelimit.KeyedLimiter, method, target string) error {
+	key := o.keyFunc(ctx, CallInfo{FullMethod: method, Target: target})
+	if err := limiter.TakeContext(ctx, key); err != nil {
+		return toStatus(err)
+	}
+	return nil
+}
+
+// toStatus converts limiter errors to grpc status errors, a key the limiter
+// doesn't know is a misconfiguration that retrying won't fix
+func toStatus(err error) error {
+	if s := status.FromContextError(err); s.Code() != codes.Unknown {
+		return s.Err()
+	}
+	if errors.Is(err, ratelimit.ErrKeyMissing) || errors.Is(err, ratelimit.ErrEmptyKey) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.ResourceExhausted, err.Error())
+}
@@ -0,0 +1,145 @@
+package grpclimit_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/projectdiscovery/ratelimit/grpclimit"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial starts a health server with the given server options and returns a client to it
+func dial(t *testing.T, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) healthpb.HealthClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(serverOpts...)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	dialOpts = append(dialOpts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestServerInterceptors(t *testing.T) {
+	t.Run("Unary By Method", func(t *testing.T) {
+		limiter := ratelimit.NewAutoLimiter(context.Background(), ratelimit.WithMaxCount(2), ratelimit.WithDuration(time.Hour))
+		defer limiter.Stop()
+		client := dial(t, []grpc.ServerOption{grpc.UnaryInterceptor(grpclimit.UnaryServerInterceptor(limiter))})
+
+		for i := 0; i < 2; i++ {
+			_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+			require.Nil(t, err)
+		}
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("Unary By Metadata", func(t *testing.T) {
+		limiter := ratelimit.NewAutoLimiter(context.Background(), ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour))
+		defer limiter.Stop()
+		interceptor := grpclimit.UnaryServerInterceptor(limiter, grpclimit.WithKeyFunc(grpclimit.ByMetadata("tenant")))
+		client := dial(t, []grpc.ServerOption{grpc.UnaryInterceptor(interceptor)})
+
+		for _, tenant := range []string{"a", "b"} {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "tenant", tenant)
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+			require.Nil(t, err)
+		}
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "tenant", "a")
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("Unary Missing Key", func(t *testing.T) {
+		limiter, err := ratelimit.NewMultiLimiter(context.Background(), &ratelimit.Options{
+			Key:      "/other.Service/Method",
+			MaxCount: 1,
+			Duration: time.Hour,
+		})
+		require.Nil(t, err)
+		defer limiter.Stop()
+		client := dial(t, []grpc.ServerOption{grpc.UnaryInterceptor(grpclimit.UnaryServerInterceptor(limiter))})
+
+		_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("Stream By Peer", func(t *testing.T) {
+		limiter := ratelimit.NewAutoLimiter(context.Background(), ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour))
+		defer limiter.Stop()
+		interceptor := grpclimit.StreamServerInterceptor(limiter, grpclimit.WithKeyFunc(grpclimit.ByPeer()))
+		client := dial(t, []grpc.ServerOption{grpc.StreamInterceptor(interceptor)})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		require.Nil(t, err)
+		_, err = stream.Recv()
+		require.Nil(t, err)
+
+		stream, err = client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		require.Nil(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+}
+
+func TestClientInterceptors(t *testing.T) {
+	t.Run("Unary", func(t *testing.T) {
+		limiter := ratelimit.NewAutoLimiter(context.Background(), ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour))
+		defer limiter.Stop()
+		client := dial(t, nil, grpc.WithUnaryInterceptor(grpclimit.UnaryClientInterceptor(limiter)))
+
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.Nil(t, err)
+
+		// the client waits for a token until the deadline
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	})
+
+	t.Run("Stream By Target", func(t *testing.T) {
+		limiter := ratelimit.NewAutoLimiter(context.Background(), ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour))
+		defer limiter.Stop()
+		interceptor := grpclimit.StreamClientInterceptor(limiter, grpclimit.WithKeyFunc(grpclimit.ByPeer()))
+		client := dial(t, nil, grpc.WithStreamInterceptor(interceptor))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		require.Nil(t, err)
+		ok, err := limiter.TryTake("passthrough:///bufnet")
+		require.Nil(t, err)
+		require.False(t, ok)
+
+		waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer waitCancel()
+		_, err = client.Watch(waitCtx, &healthpb.HealthCheckRequest{})
+		require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	})
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Origin tells where the settings of a key come from
+type Origin uint8
+
+const (
+	// OriginDefault keys use the default settings of the keyed limiter
+	OriginDefault Origin = iota
+	// OriginCustom keys were added or updated with their own settings
+	OriginCustom
+	// OriginRule keys use the settings of the first rule matching them
+	OriginRule
+)
+
+// String returns the name of the origin
+func (o Origin) String() string {
+	switch o {
+	case OriginCustom:
+		return "custom"
+	case OriginRule:
+		return "rule"
+	default:
+		return "default"
+	}
+}
+
+// KeyInfo describes the configuration and usage of a key
+type KeyInfo struct {
+	Key         string
+	Limit       uint
+	Duration    time.Duration
+	Strategy    Strategy
+	IsUnlimited bool
+	Origin      Origin
+	// LastUsed is the time of the last granted token, zero if none was granted
+	// since the limiter of the key was created
+	LastUsed time.Time
+}
+
+// info describes the limiter as key
+func (limiter *Limiter) info(key string, origin Origin) KeyInfo {
+	info := KeyInfo{
+		Key:         key,
+		Limit:       limiter.GetLimit(),
+		Duration:    limiter.getDuration(),
+		Strategy:    limiter.strategy,
+		IsUnlimited: limiter.maxCount.Load() == math.MaxUint32,
+		Origin:      origin,
+	}
+	if lastUsed := limiter.lastUsed.Load(); lastUsed != 0 {
+		info.LastUsed = time.Unix(0, lastUsed)
+	}
+	return info
+}
+
+// optionsInfo describes a key without a limiter
+func optionsInfo(key string, isUnlimited bool, max uint, duration time.Duration, origin Origin) KeyInfo {
+	if isUnlimited {
+		max, duration = math.MaxUint32, time.Millisecond
+	}
+	return KeyInfo{
+		Key:         key,
+		Limit:       max,
+		Duration:    duration,
+		IsUnlimited: isUnlimited,
+		Origin:      origin,
+	}
+}
+
+// keysOf returns the sorted keys having a limiter or stored options
+func keysOf(limiters, options *sync.Map) []string {
+	seen := make(map[string]struct{})
+	collect := func(key, _ any) bool {
+		if k, ok := key.(string); ok {
+			seen[k] = struct{}{}
+		}
+		return true
+	}
+	limiters.Range(collect)
+	options.Range(collect)
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiLimiterInfo(t *testing.T) {
+	limiter, err := NewMultiLimiter(context.Background(), &Options{Key: "b", MaxCount: 5, Duration: time.Minute})
+	require.NoError(t, err)
+	defer limiter.Stop()
+	require.NoError(t, limiter.Add(&Options{Key: "a", IsUnlimited: true}))
+	require.NoError(t, limiter.SetDefaults(&Options{MaxCount: 2, Duration: time.Second}))
+
+	before := time.Now()
+	require.NoError(t, limiter.Take("b"))
+	require.NoError(t, limiter.Take("c"))
+
+	require.Equal(t, []string{"a", "b", "c"}, limiter.Keys())
+	require.Equal(t, 3, limiter.Len())
+
+	info, err := limiter.Info("b")
+	require.NoError(t, err)
+	require.Equal(t, uint(5), info.Limit)
+	require.Equal(t, time.Minute, info.Duration)
+	require.Equal(t, None, info.Strategy)
+	require.Equal(t, OriginCustom, info.Origin)
+	require.False(t, info.IsUnlimited)
+	require.False(t, info.LastUsed.Before(before))
+
+	info, err = limiter.Info("a")
+	require.NoError(t, err)
+	require.True(t, info.IsUnlimited)
+	require.Equal(t, uint(math.MaxUint32), info.Limit)
+	require.True(t, info.LastUsed.IsZero())
+
+	info, err = limiter.Info("c")
+	require.NoError(t, err)
+	require.Equal(t, OriginDefault, info.Origin)
+	require.Equal(t, uint(2), info.Limit)
+
+	// stopped keys keep their options
+	limiter.Stop("b")
+	info, err = limiter.Info("b")
+	require.NoError(t, err)
+	require.Equal(t, uint(5), info.Limit)
+	require.True(t, info.LastUsed.IsZero())
+
+	// Info doesn't create limiters for unknown keys
+	_, err = limiter.Info("d")
+	require.True(t, errors.Is(err, ErrKeyMissing))
+	require.Equal(t, 3, limiter.Len())
+
+	var keys []string
+	for key, info := range limiter.All() {
+		require.Equal(t, key, info.Key)
+		keys = append(keys, key)
+	}
+	require.Equal(t, []string{"a", "b", "c"}, keys)
+}
+
+func TestAutoLimiterInfo(t *testing.T) {
+	limiter := NewAutoLimiter(context.Background(), WithMaxCount(2), WithDuration(time.Second))
+	defer limiter.Stop()
+	require.NoError(t, limiter.Add("custom", WithMaxCount(5), WithDuration(time.Minute)))
+	require.Equal(t, []string{"custom"}, limiter.Keys())
+
+	before := time.Now()
+	ok, err := limiter.TryTake("auto")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.Equal(t, []string{"auto", "custom"}, limiter.Keys())
+	require.Equal(t, 2, limiter.Len())
+
+	info, err := limiter.Info("auto")
+	require.NoError(t, err)
+	require.Equal(t, OriginDefault, info.Origin)
+	require.Equal(t, uint(2), info.Limit)
+	require.Equal(t, time.Second, info.Duration)
+	require.False(t, info.LastUsed.Before(before))
+
+	info, err = limiter.Info("custom")
+	require.NoError(t, err)
+	require.Equal(t, OriginCustom, info.Origin)
+	require.Equal(t, uint(5), info.Limit)
+	require.True(t, info.LastUsed.IsZero())
+
+	// updated keys become custom
+	require.NoError(t, limiter.Update("auto", WithMaxCount(3), WithDuration(time.Second)))
+	info, err = limiter.Info("auto")
+	require.NoError(t, err)
+	require.Equal(t, OriginCustom, info.Origin)
+	require.Equal(t, uint(3), info.Limit)
+
+	_, err = limiter.Info("unknown")
+	require.True(t, errors.Is(err, ErrKeyMissing))
+
+	// stop early
+	count := 0
+	for range limiter.All() {
+		count++
+		break
+	}
+	require.Equal(t, 1, count)
+
+	limiter.Remove("custom")
+	require.Equal(t, []string{"auto"}, limiter.Keys())
+}
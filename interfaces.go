@@ -0,0 +1,66 @@
+package ratelimit
+
+import "context"
+
+// RateLimiter is a single bucket limiter
+type RateLimiter interface {
+	// Take one token waiting until it's available
+	Take()
+	// TakeContext takes one token or returns an error if ctx is done first
+	TakeContext(ctx context.Context) error
+	// TryTake takes one token without waiting and reports whether it succeeded
+	TryTake() bool
+	// CanTake checks if there is any token
+	CanTake() bool
+	// GetLimit returns the tokens allowed per period
+	GetLimit() uint
+	// Stop the limiter
+	Stop()
+}
+
+// KeyedLimiter limits by key
+type KeyedLimiter interface {
+	// Take one token of key waiting until it's available
+	Take(key string) error
+	// TakeContext takes one token of key or returns an error if ctx is done first
+	TakeContext(ctx context.Context, key string) error
+	// TryTake takes one token of key without waiting and reports whether it succeeded
+	TryTake(key string) (bool, error)
+	// CanTake checks if key has any token
+	CanTake(key string) bool
+	// GetLimit returns the tokens allowed per period of key
+	GetLimit(key string) (uint, error)
+	// Stop the limiters of keys or all of them if none is given
+	Stop(keys ...string)
+}
+
+// reserver is implemented by the limiters that can take back unused tokens
+type reserver interface {
+	// Reserve takes one token or returns an error if ctx is done first
+	Reserve(ctx context.Context) (*Reservation, error)
+	// TryReserve takes one token without waiting and reports whether it succeeded
+	TryReserve() (*Reservation, bool)
+}
+
+// keyedReserver is implemented by the keyed limiters that can take back unused tokens
+type keyedReserver interface {
+	// Reserve takes one token of key or returns an error if ctx is done first
+	Reserve(ctx context.Context, key string) (*Reservation, error)
+	// TryReserve takes one token of key without waiting and reports whether it succeeded
+	TryReserve(key string) (*Reservation, bool, error)
+}
+
+var (
+	_ RateLimiter = (*Limiter)(nil)
+	_ RateLimiter = (*Composite)(nil)
+	_ RateLimiter = (*Quota)(nil)
+
+	_ KeyedLimiter = (*MultiLimiter)(nil)
+	_ KeyedLimiter = (*AutoLimiter)(nil)
+	_ KeyedLimiter = (*FairShare)(nil)
+
+	_ reserver      = (*Limiter)(nil)
+	_ reserver      = (*Composite)(nil)
+	_ keyedReserver = (*MultiLimiter)(nil)
+	_ keyedReserver = (*AutoLimiter)(nil)
+)
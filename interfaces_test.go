@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingLimiter is a RateLimiter mock granting a fixed amount of tokens
+type countingLimiter struct {
+	left atomic.Int32
+}
+
+func (c *countingLimiter) Take() {}
+
+func (c *countingLimiter) TakeContext(ctx context.Context) error {
+	if !c.TryTake() {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (c *countingLimiter) TryTake() bool { return c.left.Add(-1) >= 0 }
+
+func (c *countingLimiter) CanTake() bool { return c.left.Load() > 0 }
+
+func (c *countingLimiter) GetLimit() uint { return 1 }
+
+func (c *countingLimiter) Stop() {}
+
+func TestInterfaces(t *testing.T) {
+	t.Run("Composite Of Interfaces", func(t *testing.T) {
+		mock := &countingLimiter{}
+		mock.left.Store(1)
+		quota, err := NewQuota("key", 5, Daily)
+		require.Nil(t, err)
+		composite := NewComposite(mock, quota, New(context.TODO(), 10, time.Hour))
+		defer composite.Stop()
+
+		require.Equal(t, uint(1), composite.GetLimit())
+		require.True(t, composite.TryTake())
+		require.False(t, composite.CanTake())
+		require.Equal(t, uint(4), quota.Remaining())
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, composite.TakeContext(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("Resolver With Keyed Limiter", func(t *testing.T) {
+		upstreams, err := NewMultiLimiter(context.TODO(), &Options{Key: "1.1.1.1:53", MaxCount: 1, Duration: time.Hour})
+		require.Nil(t, err)
+		global := &countingLimiter{}
+		global.left.Store(10)
+		resolve := func(ctx context.Context, upstream, name string) ([]string, error) {
+			return []string{upstream}, nil
+		}
+		resolver, err := NewResolver(context.TODO(), []string{"1.1.1.1"}, 0, 0, WithResolveFunc(resolve), WithUpstreamLimiter(upstreams), WithGlobalLimiter(global))
+		require.Nil(t, err)
+		defer resolver.Stop()
+
+		addrs, err := resolver.Resolve(context.TODO(), "example.com")
+		require.Nil(t, err)
+		require.Equal(t, []string{"1.1.1.1:53"}, addrs)
+		require.Equal(t, int32(9), global.left.Load())
+	})
+}
@@ -2,68 +2,160 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
+	"iter"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/projectdiscovery/utils/errkit"
 )
 
-var (
-	ErrKeyAlreadyExists = errkit.New("multilimiter: key already exists")
-	ErrKeyMissing       = errkit.New("multilimiter: key does not exist")
-)
-
-// Options of MultiLimiter
+// Options of a key of MultiLimiter and AutoLimiter
 type Options struct {
 	Key         string // Unique Identifier
 	IsUnlimited bool
 	MaxCount    uint
 	Duration    time.Duration
+	Parent      *Limiter      // tokens are taken from the parent once the key limiter grants one
+	FIFO        bool          // waiters are served in arrival order regardless of their priority
+	MaxQueue    int           // waiters beyond it get ErrQueueFull, 0 means unbounded
+	MaxWait     time.Duration // waits longer than it fail with ErrWaitTimeout, 0 means unbounded
+	Warmup      *Warmup       // ramps the limit of the new key limiters, nil means none
 }
 
 // Validate given MultiLimiter Options
 func (o *Options) Validate() error {
+	if !o.IsUnlimited && o.Key == "" {
+		return ErrEmptyKey
+	}
+	return o.validateLimits()
+}
+
+// validateLimits validates the options regardless of the key
+func (o *Options) validateLimits() error {
 	if !o.IsUnlimited {
-		if o.Key == "" {
-			return errkit.New("multilimiter: empty keys not allowed")
-		}
 		if o.MaxCount == 0 {
-			return errkit.New("multilimiter: maxcount cannot be zero")
+			return ErrZeroMaxCount
 		}
 		if o.Duration == 0 {
-			return errkit.New("multilimiter: time duration not set")
+			return ErrZeroDuration
 		}
 	}
+	if o.Warmup != nil {
+		return o.Warmup.Validate()
+	}
+	return nil
+}
+
+// configure the limiter with the options in place, keepSpent is passed to Limiter.update
+func (o *Options) configure(limiter *Limiter, keepSpent bool) error {
+	if err := limiter.update(o.IsUnlimited, o.MaxCount, o.Duration, o.Parent, keepSpent); err != nil {
+		return err
+	}
+	limiter.SetFIFO(o.FIFO)
+	limiter.SetMaxQueue(o.MaxQueue)
+	limiter.SetMaxWait(o.MaxWait)
 	return nil
 }
 
+// newLimiter creates a limiter with the options, it stops with ctx
+func (o *Options) newLimiter(ctx context.Context) *Limiter {
+	var limiter *Limiter
+	if o.IsUnlimited {
+		limiter = NewUnlimited(ctx)
+	} else {
+		limiter = New(ctx, o.MaxCount, o.Duration)
+	}
+	// a new limiter can't be an ancestor of its parent
+	_ = o.configure(limiter, false)
+	if o.Warmup != nil && !o.IsUnlimited {
+		_ = limiter.SetWarmup(*o.Warmup)
+	}
+	return limiter
+}
+
 // MultiLimiter is wrapper around Limiter than can limit based on a key
 type MultiLimiter struct {
 	limiters sync.Map // map of limiters
-	ctx      context.Context
+	options  sync.Map // map of options of the keys added with Add
+	defaults atomic.Pointer[Options]
+	// normalize maps the keys of the callers to the keys of the limiters
+	normalize atomic.Pointer[Normalizer]
+	ctx       context.Context
 }
 
 // Add new bucket with key
 func (m *MultiLimiter) Add(opts *Options) error {
+	opts = m.normalizeOptions(opts)
 	if err := opts.Validate(); err != nil {
 		return err
 	}
-	var rlimiter *Limiter
-	if opts.IsUnlimited {
-		rlimiter = NewUnlimited(m.ctx)
-	} else {
-		rlimiter = New(m.ctx, opts.MaxCount, opts.Duration)
+	if _, ok := m.limiters.Load(opts.Key); ok {
+		return errkit.Wrapf(ErrKeyAlreadyExists, "key: %v", opts.Key)
 	}
 	// ok is true if key already exists
-	_, ok := m.limiters.LoadOrStore(opts.Key, rlimiter)
-	if ok {
+	if _, ok := m.options.LoadOrStore(opts.Key, opts); ok {
 		return errkit.Wrapf(ErrKeyAlreadyExists, "key: %v", opts.Key)
 	}
+	if _, err := m.create(opts.Key, opts); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Update the options of an existing key, its limiter is reconfigured in place
+// keeping the waiters and the tokens spent in the current window
+func (m *MultiLimiter) Update(opts *Options) error {
+	opts = m.normalizeOptions(opts)
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	val, hasLimiter := m.limiters.Load(opts.Key)
+	if _, hasOptions := m.options.Load(opts.Key); !hasLimiter && !hasOptions {
+		return errkit.Wrapf(ErrKeyMissing, "key: %v", opts.Key)
+	}
+	if limiter, ok := val.(*Limiter); ok {
+		if err := opts.configure(limiter, true); err != nil {
+			return err
+		}
+	}
+	m.options.Store(opts.Key, opts)
 	return nil
 }
 
+// configureKey updates the key of opts or adds it if missing
+func (m *MultiLimiter) configureKey(opts *Options) error {
+	err := m.Update(opts)
+	if errors.Is(err, ErrKeyMissing) {
+		err = m.Add(opts)
+	}
+	return err
+}
+
+// SetDefaults sets the options of the keys that were not added with Add,
+// such keys are created on first use instead of returning ErrKeyMissing
+func (m *MultiLimiter) SetDefaults(opts *Options) error {
+	if err := opts.validateLimits(); err != nil {
+		return err
+	}
+	m.defaults.Store(opts)
+	return nil
+}
+
+// SetNormalizer sets the normalizer applied to the keys on every call,
+// nil removes it, the keys already added are not normalized again
+func (m *MultiLimiter) SetNormalizer(normalize Normalizer) {
+	if normalize == nil {
+		m.normalize.Store(nil)
+		return
+	}
+	m.normalize.Store(&normalize)
+}
+
 // GetLimit returns current ratelimit of given key
 func (m *MultiLimiter) GetLimit(key string) (uint, error) {
+	key = m.normalizeKey(key)
 	limiter, err := m.get(key)
 	if err != nil {
 		return 0, err
@@ -73,25 +165,135 @@ func (m *MultiLimiter) GetLimit(key string) (uint, error) {
 
 // Take one token from bucket returns error if key not present
 func (m *MultiLimiter) Take(key string) error {
+	key = m.normalizeKey(key)
 	limiter, err := m.get(key)
 	if err != nil {
 		return err
 	}
-	limiter.Take()
-	return nil
+	return limiter.TakeContext(context.Background())
 }
 
-// CanTake checks if the rate limiter with the given key has any token
-func (m *MultiLimiter) CanTake(key string) bool {
+// TakeContext takes one token from bucket or returns error if key not present
+// or the context is done before a token is available
+func (m *MultiLimiter) TakeContext(ctx context.Context, key string) error {
+	key = m.normalizeKey(key)
+	limiter, err := m.get(key)
+	if err != nil {
+		return err
+	}
+	return limiter.TakeContext(ctx)
+}
+
+// TakeWithPriority takes one token from bucket serving higher priorities first or returns
+// error if key not present or the context is done before a token is available
+func (m *MultiLimiter) TakeWithPriority(ctx context.Context, key string, priority Priority) error {
+	key = m.normalizeKey(key)
+	limiter, err := m.get(key)
+	if err != nil {
+		return err
+	}
+	return limiter.TakeWithPriority(ctx, priority)
+}
+
+// TryTake takes one token from bucket without waiting and reports whether it succeeded
+func (m *MultiLimiter) TryTake(key string) (bool, error) {
+	key = m.normalizeKey(key)
+	limiter, err := m.get(key)
+	if err != nil {
+		return false, err
+	}
+	return limiter.TryTake(), nil
+}
+
+// Reserve takes one token from bucket like TakeContext and returns its reservation,
+// canceling it gives the token back, it returns error if key not present
+func (m *MultiLimiter) Reserve(ctx context.Context, key string) (*Reservation, error) {
+	key = m.normalizeKey(key)
 	limiter, err := m.get(key)
 	if err != nil {
+		return nil, err
+	}
+	return limiter.Reserve(ctx)
+}
+
+// TryReserve takes one token from bucket like TryTake and returns its reservation,
+// canceling it gives the token back, it returns error if key not present
+func (m *MultiLimiter) TryReserve(key string) (*Reservation, bool, error) {
+	key = m.normalizeKey(key)
+	limiter, err := m.get(key)
+	if err != nil {
+		return nil, false, err
+	}
+	reservation, ok := limiter.TryReserve()
+	return reservation, ok, nil
+}
+
+// CanTake checks if the rate limiter with the given key has any token
+func (m *MultiLimiter) CanTake(key string) bool {
+	key = m.normalizeKey(key)
+	if val, ok := m.limiters.Load(key); ok {
+		limiter, ok := val.(*Limiter)
+		return ok && limiter.CanTake()
+	}
+	opts := m.defaults.Load()
+	if val, ok := m.options.Load(key); ok {
+		opts, _ = val.(*Options)
+	}
+	if opts == nil {
 		return false
 	}
-	return limiter.CanTake()
+	// a new limiter starts with a full bucket, it is only created once a token is taken
+	return opts.Parent == nil || opts.Parent.CanTake()
+}
+
+// Keys returns the sorted keys that were added or used
+func (m *MultiLimiter) Keys() []string {
+	return keysOf(&m.limiters, &m.options)
+}
+
+// Len returns the number of keys that were added or used
+func (m *MultiLimiter) Len() int {
+	return len(m.Keys())
+}
+
+// All returns an iterator over the keys and their info
+func (m *MultiLimiter) All() iter.Seq2[string, KeyInfo] {
+	return func(yield func(string, KeyInfo) bool) {
+		for _, key := range m.Keys() {
+			info, err := m.Info(key)
+			if err != nil {
+				// removed in the meantime
+				continue
+			}
+			if !yield(key, info) {
+				return
+			}
+		}
+	}
+}
+
+// Info returns the configuration and usage of key without creating its limiter
+func (m *MultiLimiter) Info(key string) (KeyInfo, error) {
+	key = m.normalizeKey(key)
+	optsVal, custom := m.options.Load(key)
+	origin := OriginDefault
+	if custom {
+		origin = OriginCustom
+	}
+	if val, ok := m.limiters.Load(key); ok {
+		if limiter, ok := val.(*Limiter); ok {
+			return limiter.info(key, origin), nil
+		}
+	}
+	if opts, ok := optsVal.(*Options); ok {
+		return optionsInfo(key, opts.IsUnlimited, opts.MaxCount, opts.Duration, origin), nil
+	}
+	return KeyInfo{}, errkit.Wrapf(ErrKeyMissing, "key: %v", key)
 }
 
 // AddAndTake adds key if not present and then takes token from bucket
 func (m *MultiLimiter) AddAndTake(opts *Options) {
+	opts = m.normalizeOptions(opts)
 	if limiter, err := m.get(opts.Key); err == nil {
 		limiter.Take()
 		return
@@ -100,28 +302,122 @@ func (m *MultiLimiter) AddAndTake(opts *Options) {
 	_ = m.Take(opts.Key)
 }
 
-// Stop internal limiters with defined keys or all if no key is provided
+// Stop and delete internal limiters with defined keys or all if no key is provided,
+// the options of the keys are kept and their limiters are recreated on next use
 func (m *MultiLimiter) Stop(keys ...string) {
 	if len(keys) == 0 {
 		m.limiters.Range(func(key, value any) bool {
 			if limiter, ok := value.(*Limiter); ok {
 				limiter.Stop()
+				m.limiters.Delete(key)
 			}
 			return true
 		})
 		return
 	}
 	for _, v := range keys {
-		if limiter, err := m.get(v); err == nil {
-			limiter.Stop()
+		v = m.normalizeKey(v)
+		if value, ok := m.limiters.LoadAndDelete(v); ok {
+			if limiter, ok := value.(*Limiter); ok {
+				limiter.Stop()
+			}
 		}
 	}
 }
 
-// get returns *Limiter instance
+// Remove completely removes a key and its options
+func (m *MultiLimiter) Remove(key string) {
+	key = m.normalizeKey(key)
+	m.options.Delete(key)
+	m.Stop(key)
+}
+
+// refresh reconfigures in place the existing keys without options with the default ones
+func (m *MultiLimiter) refresh() error {
+	defaults := m.defaults.Load()
+	if defaults == nil {
+		return nil
+	}
+	return refreshKeys(&m.limiters, &m.options, func(string) (*Options, error) {
+		return defaults, nil
+	})
+}
+
+// refreshKeys reconfigures in place the limiters of the keys without custom options
+// with the options returned by defaultsOf keeping the tokens spent in the current window
+func refreshKeys(limiters, options *sync.Map, defaultsOf func(key string) (*Options, error)) error {
+	var errs error
+	limiters.Range(func(key, value any) bool {
+		// keys added with Add or updated keep their own settings
+		if _, custom := options.Load(key); custom {
+			return true
+		}
+		k, ok := key.(string)
+		limiter, isLimiter := value.(*Limiter)
+		if !ok || !isLimiter {
+			return true
+		}
+		opts, err := defaultsOf(k)
+		if err == nil {
+			err = opts.validateLimits()
+		}
+		if err == nil {
+			err = opts.configure(limiter, true)
+		}
+		if err != nil {
+			errs = errkit.Append(errs, errkit.Wrapf(err, "key: %v", key))
+		}
+		return true
+	})
+	return errs
+}
+
+// configParent returns the parent of the defaults or of any key
+func (m *MultiLimiter) configParent() *Limiter {
+	if defaults := m.defaults.Load(); defaults != nil && defaults.Parent != nil {
+		return defaults.Parent
+	}
+	var parent *Limiter
+	m.options.Range(func(_, value any) bool {
+		if opts, ok := value.(*Options); ok && opts.Parent != nil {
+			parent = opts.Parent
+			return false
+		}
+		return true
+	})
+	return parent
+}
+
+// normalizeKey applies the normalizer if any
+func (m *MultiLimiter) normalizeKey(key string) string {
+	normalize := m.normalize.Load()
+	if normalize == nil {
+		return key
+	}
+	return (*normalize)(key)
+}
+
+// normalizeOptions returns a copy of opts with the normalized key
+func (m *MultiLimiter) normalizeOptions(opts *Options) *Options {
+	key := m.normalizeKey(opts.Key)
+	if key == opts.Key {
+		return opts
+	}
+	normalized := *opts
+	normalized.Key = key
+	return &normalized
+}
+
+// get returns *Limiter instance creating it from the key or default options if needed
 func (m *MultiLimiter) get(key string) (*Limiter, error) {
 	val, _ := m.limiters.Load(key)
 	if val == nil {
+		if optsVal, ok := m.options.Load(key); ok {
+			return m.create(key, optsVal.(*Options))
+		}
+		if defaults := m.defaults.Load(); defaults != nil {
+			return m.create(key, defaults)
+		}
 		return nil, errkit.Wrapf(ErrKeyMissing, "key: %v", key)
 	}
 	if limiter, ok := val.(*Limiter); ok {
@@ -130,6 +426,19 @@ func (m *MultiLimiter) get(key string) (*Limiter, error) {
 	return nil, errkit.New("multilimiter: type assertion of rateLimiter failed")
 }
 
+// create the limiter of key unless another caller already did
+func (m *MultiLimiter) create(key string, opts *Options) (*Limiter, error) {
+	rlimiter := opts.newLimiter(m.ctx)
+	if val, loaded := m.limiters.LoadOrStore(key, rlimiter); loaded {
+		rlimiter.Stop()
+		if limiter, ok := val.(*Limiter); ok {
+			return limiter, nil
+		}
+		return nil, errkit.New("multilimiter: type assertion of rateLimiter failed")
+	}
+	return rlimiter, nil
+}
+
 // NewMultiLimiter : Limits
 func NewMultiLimiter(ctx context.Context, opts *Options) (*MultiLimiter, error) {
 	if err := opts.Validate(); err != nil {
@@ -138,6 +447,7 @@ func NewMultiLimiter(ctx context.Context, opts *Options) (*MultiLimiter, error)
 	multilimiter := &MultiLimiter{
 		ctx:      ctx,
 		limiters: sync.Map{},
+		options:  sync.Map{},
 	}
 	return multilimiter, multilimiter.Add(opts)
 }
@@ -2,6 +2,7 @@ package ratelimit_test
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -81,3 +82,171 @@ func TestAdaptiveLimit(t *testing.T) {
 
 	require.WithinDuration(t, start.Add(expectedDuration), time.Now(), time.Second)
 }
+
+func TestMultiLimiterParent(t *testing.T) {
+	global := ratelimit.New(context.Background(), 1, time.Hour)
+	defer global.Stop()
+	limiter, err := ratelimit.NewMultiLimiter(context.Background(), &ratelimit.Options{
+		Key:      "host",
+		MaxCount: 5,
+		Duration: time.Hour,
+		Parent:   global,
+	})
+	require.Nil(t, err)
+	defer limiter.Stop()
+
+	ok, err := limiter.TryTake("host")
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.False(t, limiter.CanTake("host"))
+	ok, err = limiter.TryTake("host")
+	require.Nil(t, err)
+	require.False(t, ok)
+}
+
+// TestMultiLimiterMigration documents how MultiLimiter and AutoLimiter users
+// can move to the shared behaviour and errors
+func TestMultiLimiterMigration(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Shared Errors", func(t *testing.T) {
+		multi, err := ratelimit.NewMultiLimiter(ctx, &ratelimit.Options{Key: "key", MaxCount: 1, Duration: time.Hour})
+		require.Nil(t, err)
+		defer multi.Stop()
+		auto := ratelimit.NewAutoLimiter(ctx)
+		defer auto.Stop()
+		require.Nil(t, auto.Add("key", ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour)))
+
+		// the deprecated AutoLimiter errors are aliases of the shared ones
+		require.True(t, errors.Is(multi.Add(&ratelimit.Options{Key: "key", MaxCount: 1, Duration: time.Hour}), ratelimit.ErrKeyAlreadyExists))
+		require.True(t, errors.Is(auto.Add("key", ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour)), ratelimit.ErrKeyAlreadyExists))
+		require.Equal(t, ratelimit.ErrKeyAlreadyExists, ratelimit.ErrAutoKeyAlreadyExists)
+		require.Equal(t, ratelimit.ErrKeyMissing, ratelimit.ErrAutoKeyMissing)
+
+		_, err = multi.TryTake("missing")
+		require.True(t, errors.Is(err, ratelimit.ErrKeyMissing))
+
+		for _, err := range []error{
+			multi.Add(&ratelimit.Options{MaxCount: 1, Duration: time.Hour}),
+			auto.Add("", ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour)),
+		} {
+			require.True(t, errors.Is(err, ratelimit.ErrEmptyKey))
+		}
+		for _, err := range []error{
+			multi.Add(&ratelimit.Options{Key: "zero", Duration: time.Hour}),
+			auto.Add("zero", ratelimit.WithDuration(time.Hour)),
+		} {
+			require.True(t, errors.Is(err, ratelimit.ErrZeroMaxCount))
+		}
+		for _, err := range []error{
+			multi.Add(&ratelimit.Options{Key: "zero", MaxCount: 1}),
+			auto.Add("zero", ratelimit.WithMaxCount(1)),
+		} {
+			require.True(t, errors.Is(err, ratelimit.ErrZeroDuration))
+		}
+	})
+
+	t.Run("Default Options", func(t *testing.T) {
+		multi, err := ratelimit.NewMultiLimiter(ctx, &ratelimit.Options{Key: "key", MaxCount: 1, Duration: time.Hour})
+		require.Nil(t, err)
+		defer multi.Stop()
+
+		// like AutoLimiter, unknown keys are created with the defaults once set
+		require.Error(t, multi.SetDefaults(&ratelimit.Options{MaxCount: 0, Duration: time.Hour}))
+		require.Nil(t, multi.SetDefaults(&ratelimit.Options{MaxCount: 2, Duration: time.Hour}))
+		limit, err := multi.GetLimit("unknown")
+		require.Nil(t, err)
+		require.Equal(t, uint(2), limit)
+		require.Nil(t, multi.Take("unknown"))
+		require.Nil(t, multi.Take("unknown"))
+		require.False(t, multi.CanTake("unknown"))
+
+		// like AutoLimiter, CanTake doesn't create the limiter
+		require.True(t, multi.CanTake("unused"))
+		require.NotContains(t, multi.Keys(), "unused")
+	})
+
+	t.Run("Stop And Remove", func(t *testing.T) {
+		multi, err := ratelimit.NewMultiLimiter(ctx, &ratelimit.Options{Key: "key", MaxCount: 1, Duration: time.Hour})
+		require.Nil(t, err)
+		defer multi.Stop()
+		require.Nil(t, multi.Take("key"))
+		require.False(t, multi.CanTake("key"))
+
+		// like AutoLimiter, Stop deletes the limiter and keeps the options
+		multi.Stop("key")
+		require.True(t, errors.Is(multi.Add(&ratelimit.Options{Key: "key", MaxCount: 5, Duration: time.Hour}), ratelimit.ErrKeyAlreadyExists))
+		limit, err := multi.GetLimit("key")
+		require.Nil(t, err)
+		require.Equal(t, uint(1), limit)
+		require.True(t, multi.CanTake("key"))
+
+		// Remove deletes the options as well
+		multi.Remove("key")
+		_, err = multi.GetLimit("key")
+		require.True(t, errors.Is(err, ratelimit.ErrKeyMissing))
+		require.Nil(t, multi.Add(&ratelimit.Options{Key: "key", MaxCount: 5, Duration: time.Hour}))
+	})
+}
+
+func TestMultiLimiterUpdate(t *testing.T) {
+	limiter, err := ratelimit.NewMultiLimiter(context.Background(), &ratelimit.Options{Key: "key", MaxCount: 1, Duration: time.Hour})
+	require.Nil(t, err)
+	defer limiter.Stop()
+
+	err = limiter.Update(&ratelimit.Options{Key: "missing", MaxCount: 1, Duration: time.Hour})
+	require.True(t, errors.Is(err, ratelimit.ErrKeyMissing))
+
+	require.Nil(t, limiter.Take("key"))
+	require.False(t, limiter.CanTake("key"))
+
+	// waiters are preserved while the limit is raised and the window shortened
+	done := make(chan error)
+	go func() {
+		done <- limiter.TakeContext(context.Background(), "key")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.Nil(t, limiter.Update(&ratelimit.Options{Key: "key", MaxCount: 5, Duration: 100 * time.Millisecond}))
+	select {
+	case err := <-done:
+		require.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not released after the update")
+	}
+	limit, err := limiter.GetLimit("key")
+	require.Nil(t, err)
+	require.Equal(t, uint(5), limit)
+
+	// the tokens spent count against a lower limit
+	require.Nil(t, limiter.Add(&ratelimit.Options{Key: "other", MaxCount: 10, Duration: time.Hour}))
+	for range 4 {
+		require.Nil(t, limiter.Take("other"))
+	}
+	require.Nil(t, limiter.Update(&ratelimit.Options{Key: "other", MaxCount: 5, Duration: time.Hour}))
+	ok, err := limiter.TryTake("other")
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = limiter.TryTake("other")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	// the stored options are used to recreate the limiter
+	limiter.Stop("key")
+	limit, err = limiter.GetLimit("key")
+	require.Nil(t, err)
+	require.Equal(t, uint(5), limit)
+}
+
+func TestMultiLimiterReservation(t *testing.T) {
+	multi, err := ratelimit.NewMultiLimiter(context.Background(), &ratelimit.Options{Key: "key", MaxCount: 1, Duration: time.Hour})
+	require.NoError(t, err)
+	defer multi.Stop()
+	reservation, err := multi.Reserve(context.Background(), "key")
+	require.NoError(t, err)
+	require.False(t, multi.CanTake("key"))
+	reservation.Cancel()
+	require.True(t, multi.CanTake("key"))
+	_, ok, err := multi.TryReserve("missing")
+	require.ErrorIs(t, err, ratelimit.ErrKeyMissing)
+	require.False(t, ok)
+}
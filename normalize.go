@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Normalizer maps the keys given by the callers to the keys of the limiters,
+// keys normalized to the same value share a budget, it must be idempotent
+type Normalizer func(key string) string
+
+// ChainNormalizers applies the normalizers in order
+func ChainNormalizers(normalizers ...Normalizer) Normalizer {
+	return func(key string) string {
+		for _, normalize := range normalizers {
+			key = normalize(key)
+		}
+		return key
+	}
+}
+
+// NormalizeURL returns the host of urls and host:port keys, i.e.,
+// https://example.com/x and example.com:443 become example.com
+func NormalizeURL(key string) string {
+	if strings.Contains(key, "://") {
+		if u, err := url.Parse(key); err == nil && u.Host != "" {
+			return u.Hostname()
+		}
+		return key
+	}
+	if host, _, err := net.SplitHostPort(key); err == nil {
+		return host
+	}
+	return key
+}
+
+// NormalizeHost lowercases the host and converts internationalized names to punycode
+func NormalizeHost(key string) string {
+	key = strings.ToLower(strings.TrimSuffix(key, "."))
+	if ascii, err := idna.Lookup.ToASCII(key); err == nil {
+		return ascii
+	}
+	return key
+}
+
+// NormalizeETLDPlusOne returns the registrable domain of the host, i.e.,
+// www.example.co.uk becomes example.co.uk, ips and unknown suffixes are kept
+func NormalizeETLDPlusOne(key string) string {
+	if _, err := netip.ParseAddr(key); err == nil {
+		return key
+	}
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(key); err == nil {
+		return domain
+	}
+	return key
+}
+
+// NormalizeIPPrefix returns the network of ip keys with the given prefix lengths,
+// i.e., 10.1.2.3 becomes 10.1.2.0/24 with v4Bits 24, other keys are kept
+func NormalizeIPPrefix(v4Bits, v6Bits int) Normalizer {
+	return func(key string) string {
+		addr, err := netip.ParseAddr(key)
+		if err != nil {
+			return key
+		}
+		addr = addr.Unmap()
+		bits := v6Bits
+		if addr.Is4() {
+			bits = v4Bits
+		}
+		prefix, err := addr.WithZone("").Prefix(bits)
+		if err != nil {
+			return key
+		}
+		return prefix.String()
+	}
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizers(t *testing.T) {
+	for input, expected := range map[string]string{
+		"https://Example.com/x":    "Example.com",
+		"example.com:443":          "example.com",
+		"http://[2001:db8::1]:80/": "2001:db8::1",
+		"[2001:db8::1]:80":         "2001:db8::1",
+		"example.com":              "example.com",
+	} {
+		require.Equal(t, expected, NormalizeURL(input), input)
+	}
+
+	require.Equal(t, "example.com", NormalizeHost("Example.COM."))
+	require.Equal(t, "xn--mnchen-3ya.de", NormalizeHost("München.de"))
+
+	require.Equal(t, "example.co.uk", NormalizeETLDPlusOne("www.example.co.uk"))
+	require.Equal(t, "10.0.0.1", NormalizeETLDPlusOne("10.0.0.1"))
+
+	prefix := NormalizeIPPrefix(24, 64)
+	require.Equal(t, "10.1.2.0/24", prefix("10.1.2.3"))
+	require.Equal(t, "10.1.2.0/24", prefix("::ffff:10.1.2.3"))
+	require.Equal(t, "2001:db8:0:1::/64", prefix("2001:db8:0:1::5"))
+	require.Equal(t, "example.com", prefix("example.com"))
+	// normalizers are idempotent
+	require.Equal(t, "10.1.2.0/24", prefix(prefix("10.1.2.3")))
+
+	chain := ChainNormalizers(NormalizeURL, NormalizeHost, NormalizeETLDPlusOne)
+	require.Equal(t, "example.com", chain("https://WWW.Example.com:8443/path"))
+}
+
+func TestAutoLimiterNormalizer(t *testing.T) {
+	limiter := NewAutoLimiter(context.Background(),
+		WithMaxCount(3), WithDuration(time.Hour),
+		WithNormalizer(ChainNormalizers(NormalizeURL, NormalizeHost)),
+	)
+	defer limiter.Stop()
+
+	for _, key := range []string{"Example.com", "example.com:443", "https://example.com/x"} {
+		ok, err := limiter.TryTake(key)
+		require.NoError(t, err)
+		require.True(t, ok, key)
+	}
+	require.False(t, limiter.CanTake("http://EXAMPLE.com"))
+	require.Equal(t, []string{"example.com"}, limiter.Keys())
+
+	require.NoError(t, limiter.Add("https://other.com/", WithMaxCount(1), WithDuration(time.Hour)))
+	info, err := limiter.Info("other.com:80")
+	require.NoError(t, err)
+	require.Equal(t, "other.com", info.Key)
+	require.Equal(t, uint(1), info.Limit)
+
+	limiter.Remove("OTHER.com")
+	require.Equal(t, []string{"example.com"}, limiter.Keys())
+}
+
+func TestMultiLimiterNormalizer(t *testing.T) {
+	limiter, err := NewMultiLimiter(context.Background(), &Options{Key: "seed", MaxCount: 1, Duration: time.Hour})
+	require.NoError(t, err)
+	defer limiter.Stop()
+	limiter.SetNormalizer(NormalizeIPPrefix(24, 64))
+
+	opts := &Options{Key: "10.0.0.1", MaxCount: 2, Duration: time.Hour}
+	require.NoError(t, limiter.Add(opts))
+	// the options of the caller are not modified
+	require.Equal(t, "10.0.0.1", opts.Key)
+	require.ErrorIs(t, limiter.Add(&Options{Key: "10.0.0.200", MaxCount: 2, Duration: time.Hour}), ErrKeyAlreadyExists)
+
+	ok, err := limiter.TryTake("10.0.0.2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = limiter.TryTake("10.0.0.3")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = limiter.TryTake("10.0.0.1")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, []string{"10.0.0.0/24", "seed"}, limiter.Keys())
+}
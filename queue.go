@@ -0,0 +1,273 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Priority of a waiter, higher priorities are served first when tokens free up
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// DefaultPriorityAging is the wait after which a waiter is served as if its priority was one level higher
+const DefaultPriorityAging = time.Second
+
+// waiter is a caller blocked until a token is granted to it
+type waiter struct {
+	priority Priority
+	since    time.Time
+	// ready is closed once the token is granted
+	ready chan struct{}
+	// window is the window of the granted token
+	window uint64
+}
+
+// waitQueue holds the waiters of a limiter, the zero value is ready to use
+type waitQueue struct {
+	mu      sync.Mutex
+	waiters []*waiter
+	// aging raises the priority of a waiter by one level every aging, 0 means DefaultPriorityAging
+	aging time.Duration
+	// fifo serves the waiters in arrival order regardless of their priority
+	fifo bool
+	// maxQueue and maxWait bound the waits, 0 means unbounded
+	maxQueue int
+	maxWait  time.Duration
+	// wake dispatches the LeakyBucket waiters once the next token is due
+	wake *time.Timer
+}
+
+// push adds a waiter with priority
+func (q *waitQueue) push(priority Priority) *waiter {
+	w := &waiter{priority: priority, since: time.Now(), ready: make(chan struct{})}
+	q.waiters = append(q.waiters, w)
+	return w
+}
+
+// pop removes the waiter to serve first
+func (q *waitQueue) pop() *waiter {
+	if len(q.waiters) == 0 {
+		return nil
+	}
+	if q.fifo {
+		w := q.waiters[0]
+		q.waiters = q.waiters[1:]
+		return w
+	}
+	now := time.Now()
+	best := 0
+	bestPriority := q.effectivePriority(q.waiters[0], now)
+	for i, w := range q.waiters[1:] {
+		if priority := q.effectivePriority(w, now); priority > bestPriority {
+			best, bestPriority = i+1, priority
+		}
+	}
+	w := q.waiters[best]
+	q.waiters = append(q.waiters[:best], q.waiters[best+1:]...)
+	return w
+}
+
+// remove the waiter and report whether it was still waiting
+func (q *waitQueue) remove(w *waiter) bool {
+	for i, current := range q.waiters {
+		if current == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// effectivePriority raises the priority of the waiter with its wait so that low priorities don't starve,
+// the waiters are kept in arrival order so ties are served first come first served
+func (q *waitQueue) effectivePriority(w *waiter, now time.Time) Priority {
+	aging := q.aging
+	if aging <= 0 {
+		aging = DefaultPriorityAging
+	}
+	return w.priority + Priority(now.Sub(w.since)/aging)
+}
+
+// TakeWithPriority takes one token from the bucket and then from the parent if any,
+// waiters with a higher priority are served first, it returns the context error
+// if it is done before a token is available
+func (limiter *Limiter) TakeWithPriority(ctx context.Context, priority Priority) error {
+	_, err := limiter.reserve(ctx, priority)
+	return err
+}
+
+// SetPriorityAging sets the wait after which a waiter is served as if its priority
+// was one level higher, 0 restores DefaultPriorityAging
+func (limiter *Limiter) SetPriorityAging(aging time.Duration) {
+	limiter.queue.mu.Lock()
+	limiter.queue.aging = aging
+	limiter.queue.mu.Unlock()
+}
+
+// SetFIFO serves the waiters strictly in arrival order regardless of their priority
+func (limiter *Limiter) SetFIFO(fifo bool) {
+	limiter.queue.mu.Lock()
+	limiter.queue.fifo = fifo
+	limiter.queue.mu.Unlock()
+}
+
+// SetMaxQueue fails the waits with ErrQueueFull once n callers are waiting, 0 means unbounded,
+// it applies to every take but Take which can't fail
+func (limiter *Limiter) SetMaxQueue(n int) {
+	limiter.queue.mu.Lock()
+	limiter.queue.maxQueue = n
+	limiter.queue.mu.Unlock()
+}
+
+// SetMaxWait fails the waits with ErrWaitTimeout once they take longer than d, the callers
+// that would wait longer for the next refill fail right away, 0 means unbounded,
+// it applies to every take but Take which can't fail
+func (limiter *Limiter) SetMaxWait(d time.Duration) {
+	limiter.queue.mu.Lock()
+	limiter.queue.maxWait = d
+	limiter.queue.mu.Unlock()
+}
+
+// takePriority takes one token from this bucket only waiting in the queue if needed
+func (limiter *Limiter) takePriority(ctx context.Context, priority Priority) (uint64, error) {
+	return limiter.waitQueued(ctx, priority, true)
+}
+
+// waitQueued takes one token from this bucket only, bounded reports whether
+// the limits set with SetMaxQueue and SetMaxWait apply, it returns the window of the token
+func (limiter *Limiter) waitQueued(ctx context.Context, priority Priority, bounded bool) (uint64, error) {
+	q := &limiter.queue
+	q.mu.Lock()
+	// tokens left over while callers wait are granted by dispatch first
+	if len(q.waiters) == 0 {
+		if window, ok := limiter.tryTake(); ok {
+			q.mu.Unlock()
+			return window, nil
+		}
+	}
+	maxWait := time.Duration(0)
+	if bounded {
+		if q.maxQueue > 0 && len(q.waiters) >= q.maxQueue {
+			q.mu.Unlock()
+			return 0, ErrQueueFull
+		}
+		if q.maxWait > 0 && limiter.expectedWait(len(q.waiters)) > q.maxWait {
+			q.mu.Unlock()
+			return 0, ErrWaitTimeout
+		}
+		maxWait = q.maxWait
+	}
+	w := q.push(priority)
+	// a refill may have happened before the push
+	limiter.dispatchLocked()
+	q.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.ready:
+		return w.window, nil
+	case <-timeout:
+		// waiters with a higher priority may have been served first
+		if limiter.cancelWait(w) {
+			return 0, ErrWaitTimeout
+		}
+		return w.window, nil
+	case <-ctx.Done():
+		if limiter.cancelWait(w) {
+			return 0, ctx.Err()
+		}
+		// the token was granted in the meantime
+		return w.window, nil
+	case <-limiter.done:
+		// a stopped limiter doesn't block anymore
+		if limiter.cancelWait(w) {
+			// no token was taken so none can be given back
+			return noWindow, nil
+		}
+		return w.window, nil
+	}
+}
+
+// expectedWait estimates the wait of a caller queued behind ahead waiters
+// from the next refill, the priorities may change it
+func (limiter *Limiter) expectedWait(ahead int) time.Duration {
+	if limiter.strategy == LeakyBucket {
+		return limiter.leakyDelay(float64(ahead + 1))
+	}
+	interval := limiter.getDuration()
+	next := time.Until(time.Unix(0, limiter.windowStart.Load()).Add(interval))
+	windows := ahead / int(max(1, limiter.windowLimit(limiter.maxCount.Load())))
+	return max(0, next) + time.Duration(windows)*interval
+}
+
+// leakyDelay estimates the wait until the LeakyBucket strategy has n tokens
+func (limiter *Limiter) leakyDelay(n float64) time.Duration {
+	tokens := limiter.leakyBucketLimiter.Tokens()
+	if tokens >= n {
+		return 0
+	}
+	perSecond := float64(limiter.leakyBucketLimiter.Limit())
+	if perSecond <= 0 {
+		return math.MaxInt64
+	}
+	seconds := (n - tokens) / perSecond
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// cancelWait removes the waiter and reports whether it was still waiting
+func (limiter *Limiter) cancelWait(w *waiter) bool {
+	limiter.queue.mu.Lock()
+	defer limiter.queue.mu.Unlock()
+	return limiter.queue.remove(w)
+}
+
+// dispatch grants the available tokens to the waiters
+func (limiter *Limiter) dispatch() {
+	limiter.queue.mu.Lock()
+	limiter.dispatchLocked()
+	limiter.queue.mu.Unlock()
+}
+
+// dispatchLocked grants the available tokens to the waiters, queue.mu must be held
+func (limiter *Limiter) dispatchLocked() {
+	for len(limiter.queue.waiters) > 0 {
+		window, ok := limiter.tryTake()
+		if !ok {
+			limiter.scheduleLocked()
+			return
+		}
+		w := limiter.queue.pop()
+		w.window = window
+		close(w.ready)
+	}
+}
+
+// scheduleLocked dispatches the LeakyBucket waiters again once the next token is due, the
+// other strategies are dispatched by the refills, queue.mu must be held
+func (limiter *Limiter) scheduleLocked() {
+	if limiter.strategy != LeakyBucket {
+		return
+	}
+	// a wake up coming a bit early schedules another one
+	delay := max(limiter.leakyDelay(1), time.Millisecond)
+	if limiter.queue.wake == nil {
+		limiter.queue.wake = time.AfterFunc(delay, limiter.dispatch)
+		return
+	}
+	limiter.queue.wake.Reset(delay)
+}
@@ -0,0 +1,318 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// queued waits until n callers wait for a token of limiter
+func queued(t *testing.T, limiter *Limiter, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		limiter.queue.mu.Lock()
+		defer limiter.queue.mu.Unlock()
+		return len(limiter.queue.waiters) == n
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestTakeWithPriority(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(ctx, 1, time.Hour)
+	defer limiter.Stop()
+	limiter.SetPriorityAging(time.Hour)
+	require.True(t, limiter.TryTake())
+
+	served := make(chan Priority, 3)
+	for i, priority := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+		go func() {
+			require.NoError(t, limiter.TakeWithPriority(ctx, priority))
+			served <- priority
+		}()
+		queued(t, limiter, i+1)
+	}
+	for _, expected := range []Priority{PriorityHigh, PriorityNormal, PriorityLow} {
+		limiter.refill(1)
+		require.Equal(t, expected, <-served)
+	}
+
+	// Take waits with the normal priority
+	done := make(chan struct{})
+	go func() {
+		limiter.Take()
+		close(done)
+	}()
+	queued(t, limiter, 1)
+	go func() {
+		require.NoError(t, limiter.TakeWithPriority(ctx, PriorityHigh))
+		served <- PriorityHigh
+	}()
+	queued(t, limiter, 2)
+	limiter.refill(1)
+	require.Equal(t, PriorityHigh, <-served)
+	limiter.refill(1)
+	<-done
+}
+
+func TestTakeWithPriorityLeaky(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLeakyBucket(ctx, 1, time.Hour)
+	limiter.SetPriorityAging(time.Hour)
+	require.True(t, limiter.TryTake())
+
+	served := make(chan Priority, 3)
+	for i, priority := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+		go func() {
+			require.NoError(t, limiter.TakeWithPriority(ctx, priority))
+			served <- priority
+		}()
+		queued(t, limiter, i+1)
+	}
+	for _, expected := range []Priority{PriorityHigh, PriorityNormal, PriorityLow} {
+		limiter.giveBack(0, 1)
+		require.Equal(t, expected, <-served)
+	}
+
+	// the waiters are served once the next token is due
+	require.NoError(t, limiter.update(false, 1, 50*time.Millisecond, nil, true))
+	start := time.Now()
+	require.NoError(t, limiter.TakeWithPriority(ctx, PriorityHigh))
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestPriorityAging(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(ctx, 1, time.Hour)
+	defer limiter.Stop()
+	limiter.SetPriorityAging(10 * time.Millisecond)
+	require.True(t, limiter.TryTake())
+
+	served := make(chan Priority, 2)
+	go func() {
+		require.NoError(t, limiter.TakeWithPriority(ctx, PriorityLow))
+		served <- PriorityLow
+	}()
+	queued(t, limiter, 1)
+	// the low priority waiter is served first after waiting long enough
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		require.NoError(t, limiter.TakeWithPriority(ctx, PriorityHigh))
+		served <- PriorityHigh
+	}()
+	queued(t, limiter, 2)
+	limiter.refill(1)
+	require.Equal(t, PriorityLow, <-served)
+	limiter.refill(1)
+	require.Equal(t, PriorityHigh, <-served)
+}
+
+func TestTakeWithPriorityCancel(t *testing.T) {
+	limiter := New(context.Background(), 1, time.Hour)
+	require.True(t, limiter.TryTake())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, limiter.TakeWithPriority(ctx, PriorityHigh), context.DeadlineExceeded)
+	queued(t, limiter, 0)
+
+	// a stopped limiter doesn't block its waiters
+	done := make(chan error)
+	go func() {
+		done <- limiter.TakeWithPriority(context.Background(), PriorityLow)
+	}()
+	queued(t, limiter, 1)
+	limiter.Stop()
+	require.NoError(t, <-done)
+	queued(t, limiter, 0)
+}
+
+func TestKeyedTakeWithPriority(t *testing.T) {
+	ctx := context.Background()
+	parent := NewAutoLimiter(ctx, WithMaxCount(2), WithDuration(time.Hour))
+	defer parent.Stop()
+	auto := NewAutoLimiter(ctx, WithMaxCount(2), WithDuration(time.Hour), WithParentKey(parent, nil))
+	defer auto.Stop()
+	require.NoError(t, auto.TakeWithPriority(ctx, "key", PriorityHigh))
+	ok, err := parent.TryTake("key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, parent.CanTake("key"))
+
+	multi, err := NewMultiLimiter(ctx, &Options{Key: "key", MaxCount: 1, Duration: time.Hour})
+	require.NoError(t, err)
+	defer multi.Stop()
+	require.NoError(t, multi.TakeWithPriority(ctx, "key", PriorityLow))
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, multi.TakeWithPriority(timeout, "key", PriorityHigh), context.DeadlineExceeded)
+	require.ErrorIs(t, multi.TakeWithPriority(ctx, "missing", PriorityHigh), ErrKeyMissing)
+}
+
+func TestFIFO(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(ctx, 1, time.Hour)
+	defer limiter.Stop()
+	limiter.SetFIFO(true)
+	require.True(t, limiter.TryTake())
+
+	served := make(chan Priority, 2)
+	for i, priority := range []Priority{PriorityLow, PriorityHigh} {
+		go func() {
+			require.NoError(t, limiter.TakeWithPriority(ctx, priority))
+			served <- priority
+		}()
+		queued(t, limiter, i+1)
+	}
+	limiter.refill(1)
+	require.Equal(t, PriorityLow, <-served)
+	limiter.refill(1)
+	require.Equal(t, PriorityHigh, <-served)
+
+	auto := NewAutoLimiter(ctx, WithMaxCount(1), WithDuration(time.Hour), WithFIFO())
+	defer auto.Stop()
+	require.NoError(t, auto.Take("key"))
+	keyLimiter, err := auto.get("key")
+	require.NoError(t, err)
+	require.True(t, keyLimiter.queue.fifo)
+}
+
+func TestFIFOBoundedWait(t *testing.T) {
+	ctx := context.Background()
+	const workers, takes = 50, 3
+
+	// maxWait runs the workers and returns the longest single wait
+	maxWait := func(take func()) time.Duration {
+		waits := make(chan time.Duration, workers*takes)
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range takes {
+					start := time.Now()
+					take()
+					waits <- time.Since(start)
+				}
+			}()
+		}
+		wg.Wait()
+		close(waits)
+		var longest time.Duration
+		for wait := range waits {
+			longest = max(longest, wait)
+		}
+		return longest
+	}
+
+	// every waiter is served after at most the workers ahead of it, 5 windows
+	limiter := New(ctx, 10, 20*time.Millisecond)
+	defer limiter.Stop()
+	limiter.SetFIFO(true)
+	require.Less(t, maxWait(limiter.Take), 300*time.Millisecond)
+
+	// 50 tokens ahead at most, 100ms
+	leaky := NewLeakyBucket(ctx, 1, 2*time.Millisecond)
+	leaky.SetFIFO(true)
+	require.Less(t, maxWait(leaky.Take), 250*time.Millisecond)
+}
+
+func TestMaxQueue(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(ctx, 1, time.Hour)
+	defer limiter.Stop()
+	limiter.SetMaxQueue(1)
+	require.True(t, limiter.TryTake())
+
+	done := make(chan error)
+	go func() {
+		done <- limiter.TakeContext(ctx)
+	}()
+	queued(t, limiter, 1)
+	require.ErrorIs(t, limiter.TakeContext(ctx), ErrQueueFull)
+	require.ErrorIs(t, limiter.TakeWithPriority(ctx, PriorityHigh), ErrQueueFull)
+	limiter.refill(1)
+	require.NoError(t, <-done)
+
+	leaky := NewLeakyBucket(ctx, 1, time.Hour)
+	leaky.SetMaxQueue(1)
+	require.NoError(t, leaky.TakeContext(ctx))
+	timeout, cancel := context.WithCancel(ctx)
+	go func() {
+		done <- leaky.TakeContext(timeout)
+	}()
+	queued(t, leaky, 1)
+	require.ErrorIs(t, leaky.TakeContext(ctx), ErrQueueFull)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestMaxWait(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(ctx, 1, time.Hour)
+	defer limiter.Stop()
+	require.True(t, limiter.TryTake())
+	// the next refill is too far away
+	limiter.SetMaxWait(time.Minute)
+	start := time.Now()
+	require.ErrorIs(t, limiter.TakeContext(ctx), ErrWaitTimeout)
+	require.Less(t, time.Since(start), time.Second)
+	queued(t, limiter, 0)
+
+	// the refill is late, the wait times out
+	limiter.windowStart.Store(time.Now().Add(-time.Hour).UnixNano())
+	limiter.SetMaxWait(20 * time.Millisecond)
+	require.ErrorIs(t, limiter.TakeContext(ctx), ErrWaitTimeout)
+	queued(t, limiter, 0)
+
+	leaky := NewLeakyBucket(ctx, 1, time.Hour)
+	leaky.SetMaxWait(time.Minute)
+	require.NoError(t, leaky.TakeContext(ctx))
+	require.ErrorIs(t, leaky.TakeContext(ctx), ErrWaitTimeout)
+	// no token was spent by the refused wait
+	require.InDelta(t, 0, leaky.leakyBucketLimiter.Tokens(), 0.01)
+
+	// Take is not bounded, TakeBounded is
+	limiter.SetMaxQueue(1)
+	limiter.SetMaxWait(time.Nanosecond)
+	go limiter.refill(1)
+	limiter.Take()
+	require.ErrorIs(t, limiter.TakeBounded(), ErrWaitTimeout)
+}
+
+func TestBoundedParent(t *testing.T) {
+	ctx := context.Background()
+	parent := New(ctx, 1, time.Hour)
+	defer parent.Stop()
+	require.True(t, parent.TryTake())
+	parent.SetMaxWait(time.Minute)
+	child := New(ctx, 5, time.Hour)
+	defer child.Stop()
+	require.NoError(t, child.SetParent(parent))
+
+	// the token of the child goes back when the parent fails
+	require.ErrorIs(t, child.TakeContext(ctx), ErrWaitTimeout)
+	require.Equal(t, uint32(5), child.count.Load())
+	require.ErrorIs(t, child.TakeWithPriority(ctx, PriorityHigh), ErrWaitTimeout)
+	require.Equal(t, uint32(5), child.count.Load())
+	require.Zero(t, child.lastUsed.Load())
+}
+
+func TestKeyedMaxQueue(t *testing.T) {
+	ctx := context.Background()
+	auto := NewAutoLimiter(ctx, WithMaxCount(1), WithDuration(time.Hour), WithMaxQueue(2), WithMaxWait(time.Minute))
+	defer auto.Stop()
+	require.NoError(t, auto.Take("key"))
+	require.ErrorIs(t, auto.Take("key"), ErrWaitTimeout)
+	keyLimiter, err := auto.get("key")
+	require.NoError(t, err)
+	require.Equal(t, 2, keyLimiter.queue.maxQueue)
+
+	multi, err := NewMultiLimiter(ctx, &Options{Key: "key", MaxCount: 1, Duration: time.Hour, MaxWait: time.Minute})
+	require.NoError(t, err)
+	defer multi.Stop()
+	require.NoError(t, multi.Take("key"))
+	require.ErrorIs(t, multi.Take("key"), ErrWaitTimeout)
+}
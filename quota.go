@@ -0,0 +1,287 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// Period is the calendar period a quota is reset on
+type Period uint8
+
+const (
+	Hourly Period = iota
+	Daily
+	Monthly
+)
+
+// valid reports whether p is one of the known periods
+func (p Period) valid() bool {
+	return p <= Monthly
+}
+
+// start returns the beginning of the period containing t
+func (p Period) start(t time.Time) time.Time {
+	switch p {
+	case Hourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case Daily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// next returns the beginning of the period following the one starting at start
+func (p Period) next(start time.Time) time.Time {
+	switch p {
+	case Hourly:
+		return time.Date(start.Year(), start.Month(), start.Day(), start.Hour()+1, 0, 0, 0, start.Location())
+	case Daily:
+		return time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, start.Location())
+	default:
+		return time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, start.Location())
+	}
+}
+
+// QuotaState is the persisted state of a quota
+type QuotaState struct {
+	PeriodStart time.Time `json:"period_start"`
+	Used        uint      `json:"used"`
+}
+
+// QuotaStore persists quota states by key
+type QuotaStore interface {
+	// Load returns the state of key or nil if there is none
+	Load(key string) (*QuotaState, error)
+	// Save the state of key
+	Save(key string, state *QuotaState) error
+}
+
+// QuotaFileStore is a QuotaStore keeping all the states in a json file
+type QuotaFileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewQuotaFileStore creates a file store at the given path, the file is created on first save
+func NewQuotaFileStore(path string) *QuotaFileStore {
+	return &QuotaFileStore{path: path}
+}
+
+// Load returns the state of key or nil if there is none
+func (f *QuotaFileStore) Load(key string) (*QuotaState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	states, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	state, ok := states[key]
+	if !ok {
+		return nil, nil
+	}
+	return state, nil
+}
+
+// Save the state of key
+func (f *QuotaFileStore) Save(key string, state *QuotaState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	states, err := f.read()
+	if err != nil {
+		return err
+	}
+	states[key] = state
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a partial file behind
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (f *QuotaFileStore) read() (map[string]*QuotaState, error) {
+	states := make(map[string]*QuotaState)
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, errkit.Wrapf(err, "quota: invalid store file %v", f.path)
+	}
+	return states, nil
+}
+
+// QuotaOption is a function that configures the Quota
+type QuotaOption func(*Quota)
+
+// WithQuotaLocation sets the time zone the periods are aligned to, default is UTC
+func WithQuotaLocation(location *time.Location) QuotaOption {
+	return func(q *Quota) {
+		q.location = location
+	}
+}
+
+// WithQuotaStore sets the store the consumed count is persisted to
+func WithQuotaStore(store QuotaStore) QuotaOption {
+	return func(q *Quota) {
+		q.store = store
+	}
+}
+
+// Quota allows max tokens per calendar period, i.e., 10000 per month
+type Quota struct {
+	mu       sync.Mutex
+	key      string
+	max      uint
+	period   Period
+	location *time.Location
+	store    QuotaStore
+	state    QuotaState
+	now      func() time.Time
+}
+
+// NewQuota creates a quota identified by key in the store allowing max tokens per period
+func NewQuota(key string, max uint, period Period, opts ...QuotaOption) (*Quota, error) {
+	if key == "" {
+		return nil, ErrEmptyKey
+	}
+	if max == 0 {
+		return nil, ErrZeroMaxCount
+	}
+	if !period.valid() {
+		return nil, errkit.Newf("quota: unknown period %d", period)
+	}
+	q := &Quota{
+		key:      key,
+		max:      max,
+		period:   period,
+		location: time.UTC,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	q.state.PeriodStart = q.period.start(q.now().In(q.location))
+	if q.store != nil {
+		state, err := q.store.Load(key)
+		if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			q.state = *state
+		}
+	}
+	return q, nil
+}
+
+// Take one token waiting for the next period if the quota is exhausted
+func (q *Quota) Take() {
+	_ = q.TakeContext(context.TODO())
+}
+
+// TakeContext takes one token waiting for the next period if the quota is exhausted,
+// it returns the context error if it is done first or the store error if any
+func (q *Quota) TakeContext(ctx context.Context) error {
+	for {
+		ok, err := q.tryTake()
+		if ok || err != nil {
+			return err
+		}
+		timer := time.NewTimer(time.Until(q.PeriodEnd()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// TryTake takes one token without waiting and reports whether it succeeded,
+// the token is not granted if it can't be persisted
+func (q *Quota) TryTake() bool {
+	ok, _ := q.tryTake()
+	return ok
+}
+
+// CanTake checks if the quota has any token left
+func (q *Quota) CanTake() bool {
+	return q.Remaining() > 0
+}
+
+// GetLimit returns the tokens allowed per period
+func (q *Quota) GetLimit() uint {
+	return q.max
+}
+
+// Stop is a no-op kept for parity with Limiter, the quota doesn't hold any resource
+func (q *Quota) Stop() {}
+
+// Remaining returns the tokens left in the current period
+func (q *Quota) Remaining() uint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll()
+	if q.state.Used >= q.max {
+		return 0
+	}
+	return q.max - q.state.Used
+}
+
+// PeriodEnd returns when the current period ends and the quota is reset
+func (q *Quota) PeriodEnd() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll()
+	return q.period.next(q.state.PeriodStart.In(q.location))
+}
+
+func (q *Quota) tryTake() (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.roll()
+	if q.state.Used >= q.max {
+		return false, nil
+	}
+	q.state.Used++
+	if q.store != nil {
+		if err := q.store.Save(q.key, &q.state); err != nil {
+			q.state.Used--
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// roll starts a new period if the current one is over
+func (q *Quota) roll() {
+	start := q.period.start(q.now().In(q.location))
+	if start.After(q.state.PeriodStart) {
+		q.state = QuotaState{PeriodStart: start}
+	}
+}
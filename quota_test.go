@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingStore struct{}
+
+func (failingStore) Load(key string) (*QuotaState, error) { return nil, nil }
+
+func (failingStore) Save(key string, state *QuotaState) error { return errors.New("store unavailable") }
+
+func TestQuota(t *testing.T) {
+	t.Run("Persisted Across Restarts", func(t *testing.T) {
+		store := NewQuotaFileStore(filepath.Join(t.TempDir(), "quota.json"))
+		quota, err := NewQuota("api-key", 3, Monthly, WithQuotaStore(store))
+		require.Nil(t, err)
+		require.True(t, quota.TryTake())
+		require.True(t, quota.TryTake())
+		require.Equal(t, uint(1), quota.Remaining())
+		require.Equal(t, uint(3), quota.GetLimit())
+
+		restarted, err := NewQuota("api-key", 3, Monthly, WithQuotaStore(store))
+		require.Nil(t, err)
+		require.Equal(t, uint(1), restarted.Remaining())
+		require.Nil(t, restarted.TakeContext(context.TODO()))
+		require.False(t, restarted.CanTake())
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, restarted.TakeContext(ctx), context.DeadlineExceeded)
+
+		other, err := NewQuota("other-key", 3, Monthly, WithQuotaStore(store))
+		require.Nil(t, err)
+		require.Equal(t, uint(3), other.Remaining())
+	})
+
+	t.Run("Calendar Periods", func(t *testing.T) {
+		location, err := time.LoadLocation("America/New_York")
+		require.Nil(t, err)
+		now := time.Date(2024, time.January, 31, 23, 30, 0, 0, location)
+
+		quota, err := NewQuota("monthly", 1, Monthly, WithQuotaLocation(location))
+		require.Nil(t, err)
+		quota.now = func() time.Time { return now }
+		quota.state.PeriodStart = Monthly.start(now)
+		require.True(t, quota.TryTake())
+		require.False(t, quota.TryTake())
+		require.Equal(t, time.Date(2024, time.February, 1, 0, 0, 0, 0, location), quota.PeriodEnd())
+
+		// 05:00 UTC is still january in new york
+		now = time.Date(2024, time.February, 1, 4, 59, 0, 0, time.UTC)
+		require.False(t, quota.CanTake())
+		now = time.Date(2024, time.February, 1, 5, 0, 0, 0, time.UTC)
+		require.True(t, quota.TryTake())
+
+		hourly := time.Date(2024, time.March, 10, 1, 15, 0, 0, location)
+		require.Equal(t, time.Date(2024, time.March, 10, 1, 0, 0, 0, location), Hourly.start(hourly))
+		require.Equal(t, time.Date(2024, time.March, 11, 0, 0, 0, 0, location), Daily.next(Daily.start(hourly)))
+	})
+
+	t.Run("Store Failure", func(t *testing.T) {
+		quota, err := NewQuota("failing", 1, Daily, WithQuotaStore(failingStore{}))
+		require.Nil(t, err)
+		require.False(t, quota.TryTake())
+		require.Error(t, quota.TakeContext(context.TODO()))
+		require.Equal(t, uint(1), quota.Remaining())
+	})
+
+	t.Run("Invalid Options", func(t *testing.T) {
+		_, err := NewQuota("", 1, Daily)
+		require.ErrorIs(t, err, ErrEmptyKey)
+		_, err = NewQuota("key", 0, Daily)
+		require.ErrorIs(t, err, ErrZeroMaxCount)
+		_, err = NewQuota("key", 1, Monthly+1)
+		require.ErrorContains(t, err, "unknown period")
+	})
+}
@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// Rate is a parsed rate expression from which limiters can be built, i.e.,
+// 100/s, 1000/1m, 5/10s burst 20, leaky:50/s or unlimited
+type Rate struct {
+	MaxCount  uint
+	Duration  time.Duration
+	Burst     uint // tokens allowed at once, 0 means MaxCount
+	Strategy  Strategy
+	Unlimited bool
+}
+
+// ParseRate parses a rate expression, the duration is either a unit (ms, s, m, h)
+// or a go duration (10s, 1m30s), leaky: selects the LeakyBucket strategy
+func ParseRate(expr string) (Rate, error) {
+	var r Rate
+	fields := strings.Fields(strings.ToLower(expr))
+	if len(fields) == 1 && fields[0] == "unlimited" {
+		r.Unlimited = true
+		return r, nil
+	}
+	if len(fields) != 1 && len(fields) != 3 {
+		return r, errkit.Newf("ratelimit: invalid rate %q", expr)
+	}
+	if len(fields) == 3 {
+		if fields[1] != "burst" {
+			return r, errkit.Newf("ratelimit: invalid rate %q, expected burst", expr)
+		}
+		burst, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil || burst == 0 {
+			return r, errkit.Newf("ratelimit: invalid burst in rate %q", expr)
+		}
+		r.Burst = uint(burst)
+	}
+	spec := fields[0]
+	if after, ok := strings.CutPrefix(spec, "leaky:"); ok {
+		r.Strategy = LeakyBucket
+		spec = after
+	}
+	count, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return r, errkit.Newf("ratelimit: invalid rate %q, expected count/duration", expr)
+	}
+	maxCount, err := strconv.ParseUint(count, 10, 32)
+	if err != nil {
+		return r, errkit.Newf("ratelimit: invalid count in rate %q", expr)
+	}
+	if maxCount == 0 {
+		return r, ErrZeroMaxCount
+	}
+	r.MaxCount = uint(maxCount)
+	// a bare unit means one of it
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	if r.Duration, err = time.ParseDuration(period); err != nil {
+		return r, errkit.Newf("ratelimit: invalid duration in rate %q", expr)
+	}
+	if r.Duration <= 0 {
+		return r, ErrZeroDuration
+	}
+	return r, nil
+}
+
+// String returns the rate expression, ParseRate(r.String()) returns r
+func (r Rate) String() string {
+	if r.Unlimited {
+		return "unlimited"
+	}
+	if r.MaxCount == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	if r.Strategy == LeakyBucket {
+		sb.WriteString("leaky:")
+	}
+	fmt.Fprintf(&sb, "%d/%s", r.MaxCount, formatPeriod(r.Duration))
+	if r.Burst != 0 {
+		fmt.Fprintf(&sb, " burst %d", r.Burst)
+	}
+	return sb.String()
+}
+
+// Set parses the rate expression of a flag
+func (r *Rate) Set(expr string) error {
+	parsed, err := ParseRate(expr)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// MarshalText returns the rate expression
+func (r Rate) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText parses a rate expression
+func (r *Rate) UnmarshalText(text []byte) error {
+	return r.Set(string(text))
+}
+
+// Validate checks that a limited rate has a count and a duration, the zero Rate is invalid
+func (r Rate) Validate() error {
+	if r.Unlimited {
+		return nil
+	}
+	if r.MaxCount == 0 {
+		return ErrZeroMaxCount
+	}
+	if r.Duration <= 0 {
+		return ErrZeroDuration
+	}
+	return nil
+}
+
+// NewLimiter builds a limiter allowing the rate, a burst requires the tokens to be
+// spread over the duration so it implies the LeakyBucket strategy
+func (r Rate) NewLimiter(ctx context.Context) (*Limiter, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	switch {
+	case r.Unlimited:
+		return NewUnlimited(ctx), nil
+	case r.Strategy == LeakyBucket || r.Burst != 0:
+		burst := r.Burst
+		if burst == 0 {
+			burst = r.MaxCount
+		}
+		// the leaky bucket grants a token every duration
+		return NewLeakyBucket(ctx, burst, r.Duration/time.Duration(r.MaxCount)), nil
+	default:
+		return New(ctx, r.MaxCount, r.Duration), nil
+	}
+}
+
+// Options returns the MultiLimiter options of key with the rate, keyed limiters
+// use the default strategy so a burst or the LeakyBucket strategy is an error
+func (r Rate) Options(key string) (*Options, error) {
+	if err := r.keyed(); err != nil {
+		return nil, err
+	}
+	return &Options{Key: key, IsUnlimited: r.Unlimited, MaxCount: r.MaxCount, Duration: r.Duration}, nil
+}
+
+// AutoLimiterOptions returns the AutoLimiter options with the rate, keyed limiters
+// use the default strategy so a burst or the LeakyBucket strategy is an error
+func (r Rate) AutoLimiterOptions() ([]AutoLimiterOption, error) {
+	if err := r.keyed(); err != nil {
+		return nil, err
+	}
+	if r.Unlimited {
+		return []AutoLimiterOption{WithUnlimited()}, nil
+	}
+	return []AutoLimiterOption{WithMaxCount(r.MaxCount), WithDuration(r.Duration)}, nil
+}
+
+// keyed checks that the rate can be applied to a keyed limiter
+func (r Rate) keyed() error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if r.Burst != 0 || r.Strategy == LeakyBucket {
+		return errkit.Newf("ratelimit: rate %q not supported by keyed limiters", r)
+	}
+	return nil
+}
+
+// formatPeriod formats the duration with a single unit when possible, i.e., s or 10s
+func formatPeriod(d time.Duration) string {
+	for _, unit := range []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+	} {
+		if d%unit.duration == 0 {
+			if n := d / unit.duration; n != 1 {
+				return strconv.FormatInt(int64(n), 10) + unit.name
+			}
+			return unit.name
+		}
+	}
+	return d.String()
+}
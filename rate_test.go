@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	for expr, expected := range map[string]Rate{
+		"100/s":             {MaxCount: 100, Duration: time.Second},
+		"1000/1m":           {MaxCount: 1000, Duration: time.Minute},
+		"10/5m":             {MaxCount: 10, Duration: 5 * time.Minute},
+		"150/S":             {MaxCount: 150, Duration: time.Second},
+		"5/10s burst 20":    {MaxCount: 5, Duration: 10 * time.Second, Burst: 20},
+		"leaky:50/s":        {MaxCount: 50, Duration: time.Second, Strategy: LeakyBucket},
+		"2/500ms":           {MaxCount: 2, Duration: 500 * time.Millisecond},
+		"1/1m30s":           {MaxCount: 1, Duration: 90 * time.Second},
+		" unlimited ":       {Unlimited: true},
+		"leaky:1/h burst 3": {MaxCount: 1, Duration: time.Hour, Burst: 3, Strategy: LeakyBucket},
+	} {
+		r, err := ParseRate(expr)
+		require.NoError(t, err, expr)
+		require.Equal(t, expected, r, expr)
+		// String round-trips
+		parsed, err := ParseRate(r.String())
+		require.NoError(t, err, r.String())
+		require.Equal(t, r, parsed, r.String())
+	}
+	require.Equal(t, "1000/m", Rate{MaxCount: 1000, Duration: time.Minute}.String())
+	require.Equal(t, "1/90s", Rate{MaxCount: 1, Duration: 90 * time.Second}.String())
+
+	for _, expr := range []string{"", "100", "0/s", "10/0s", "x/s", "10/fortnight", "10/s burst", "10/s boost 2", "10/s burst 0", "-1/s"} {
+		_, err := ParseRate(expr)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestRateFlag(t *testing.T) {
+	var r Rate
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&r, "rl", "rate limit")
+	require.NoError(t, flags.Parse([]string{"-rl", "150/s"}))
+	require.Equal(t, Rate{MaxCount: 150, Duration: time.Second}, r)
+	require.Error(t, flags.Parse([]string{"-rl", "fast"}))
+
+	text, err := r.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "150/s", string(text))
+	require.NoError(t, r.UnmarshalText([]byte("unlimited")))
+	require.True(t, r.Unlimited)
+}
+
+func TestRateNewLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	limiter, err := Rate{MaxCount: 3, Duration: time.Hour}.NewLimiter(ctx)
+	require.NoError(t, err)
+	defer limiter.Stop()
+	require.Equal(t, None, limiter.strategy)
+	for i := 0; i < 3; i++ {
+		require.True(t, limiter.TryTake())
+	}
+	require.False(t, limiter.TryTake())
+
+	// a burst spreads the tokens of the duration
+	leaky, err := Rate{MaxCount: 100, Duration: time.Second, Burst: 2}.NewLimiter(ctx)
+	require.NoError(t, err)
+	require.Equal(t, LeakyBucket, leaky.strategy)
+	require.True(t, leaky.TryTake())
+	require.True(t, leaky.TryTake())
+	require.False(t, leaky.TryTake())
+	start := time.Now()
+	leaky.Take()
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+
+	unlimited, err := Rate{Unlimited: true}.NewLimiter(ctx)
+	require.NoError(t, err)
+	defer unlimited.Stop()
+	require.True(t, unlimited.TryTake())
+
+	autoOptions, err := Rate{MaxCount: 7, Duration: time.Second}.AutoLimiterOptions()
+	require.NoError(t, err)
+	auto := NewAutoLimiter(ctx, autoOptions...)
+	defer auto.Stop()
+	limit, err := auto.GetLimit("key")
+	require.NoError(t, err)
+	require.Equal(t, uint(7), limit)
+	options, err := Rate{MaxCount: 7, Duration: time.Second}.Options("key")
+	require.NoError(t, err)
+	require.NoError(t, options.Validate())
+
+	// an unset rate can't build a limiter
+	for _, r := range []Rate{{}, {Strategy: LeakyBucket, Duration: time.Second}, {MaxCount: 1}} {
+		_, err := r.NewLimiter(ctx)
+		require.Error(t, err)
+	}
+
+	// keyed limiters can't honour a burst or the leaky bucket
+	for _, r := range []Rate{
+		{MaxCount: 7, Duration: time.Second, Burst: 10},
+		{MaxCount: 7, Duration: time.Second, Strategy: LeakyBucket},
+		{},
+	} {
+		_, err := r.Options("key")
+		require.Error(t, err, r.String())
+		_, err = r.AutoLimiterOptions()
+		require.Error(t, err, r.String())
+	}
+}
@@ -6,35 +6,49 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/projectdiscovery/utils/errkit"
 	"golang.org/x/time/rate"
 )
 
-// equals to -1
-var minusOne = ^uint32(0)
-
 // Limiter allows a burst of request during the defined duration
 type Limiter struct {
 	strategy Strategy
 	maxCount atomic.Uint32
-	interval time.Duration
+	interval atomic.Int64 // time.Duration
 	count    atomic.Uint32
 	ticker   *time.Ticker
-	tokens   chan struct{}
-	ctx      context.Context
+	// refilled is closed and replaced every time the bucket is refilled
+	refilled atomic.Pointer[chan struct{}]
+	// done is closed once the internal loop exits
+	done chan struct{}
+	ctx  context.Context
 	// internal
 	cancelFunc context.CancelFunc
 
 	// wraps uber's leaky bucket limiter sizing it to the desired tokens per duration
 	leakyBucketLimiter *rate.Limiter
+
+	// tokens are taken from the parent once this limiter grants one
+	parent atomic.Pointer[Limiter]
+
+	// lastUsed is the unix nano time of the last granted token
+	lastUsed atomic.Int64
+	// windowStart is the unix nano time of the last refill
+	windowStart atomic.Int64
+	// realign restores the interval of the ticker reset to end a restored window
+	realign atomic.Bool
+	// window counts the refills so that the tokens of a previous window are not given back
+	window atomic.Uint64
+
+	// queue holds the callers waiting for a token
+	queue waitQueue
+	// warmup is the ramp of the limit in progress if any
+	warmup atomic.Pointer[warmupState]
 }
 
 func (limiter *Limiter) run(ctx context.Context) {
-	defer close(limiter.tokens)
+	defer close(limiter.done)
 	for {
-		if limiter.count.Load() == 0 {
-			<-limiter.ticker.C
-			limiter.count.Store(limiter.maxCount.Load())
-		}
 		select {
 		case <-ctx.Done():
 			// Internal Context
@@ -43,29 +57,199 @@ func (limiter *Limiter) run(ctx context.Context) {
 		case <-limiter.ctx.Done():
 			limiter.ticker.Stop()
 			return
-		case limiter.tokens <- struct{}{}:
-			limiter.count.Add(minusOne)
 		case <-limiter.ticker.C:
-			limiter.count.Store(limiter.maxCount.Load())
+			if limiter.realign.Swap(false) {
+				limiter.ticker.Reset(limiter.getDuration())
+			}
+			limiter.windowStart.Store(time.Now().UnixNano())
+			limiter.refill(limiter.windowLimit(limiter.maxCount.Load()))
 		}
 	}
 }
 
-// Take one token from the bucket
+// refill the bucket with count tokens waking up the waiters
+func (limiter *Limiter) refill(count uint32) {
+	limiter.window.Add(1)
+	// waiters only block on an empty bucket
+	if limiter.count.Swap(count) == 0 {
+		limiter.notify()
+	}
+}
+
+// notify grants the tokens to the queued waiters first and then wakes up the other ones
+func (limiter *Limiter) notify() {
+	limiter.dispatch()
+	next := make(chan struct{})
+	close(*limiter.refilled.Swap(&next))
+}
+
+// Take one token from the bucket and then from the parent if any, the waits are
+// not bounded by SetMaxQueue and SetMaxWait since they can't fail, see TakeBounded
 func (limiter *Limiter) Take() {
+	limiter.take()
+	limiter.touch()
+	if parent := limiter.parent.Load(); parent != nil {
+		parent.Take()
+	}
+}
+
+// TakeContext takes one token from the bucket and then from the parent if any
+// or returns the context error if it is done before a token is available
+func (limiter *Limiter) TakeContext(ctx context.Context) error {
+	_, err := limiter.reserve(ctx, PriorityNormal)
+	return err
+}
+
+// Reserve takes one token like TakeContext and returns its reservation,
+// canceling it gives the token back as long as its window is not over
+func (limiter *Limiter) Reserve(ctx context.Context) (*Reservation, error) {
+	return limiter.reserve(ctx, PriorityNormal)
+}
+
+// reserve takes one token from the bucket waiting in the queue with priority
+// and then from the parent if any
+func (limiter *Limiter) reserve(ctx context.Context, priority Priority) (*Reservation, error) {
+	window, err := limiter.takePriority(ctx, priority)
+	if err != nil {
+		return nil, err
+	}
+	reservation := newReservation(limiter, window)
+	if parent := limiter.parent.Load(); parent != nil {
+		parentReservation, err := parent.reserve(ctx, priority)
+		if err != nil {
+			// the token of this bucket is not used
+			reservation.Cancel()
+			return nil, err
+		}
+		reservation.join(parentReservation)
+	}
+	limiter.touch()
+	return reservation, nil
+}
+
+// TakeBounded takes one token like Take but fails with ErrQueueFull or ErrWaitTimeout
+// beyond the limits set with SetMaxQueue and SetMaxWait
+func (limiter *Limiter) TakeBounded() error {
+	return limiter.TakeContext(context.Background())
+}
+
+// TryTake takes one token from the bucket and the parent if any without waiting
+// for a refill and reports whether it succeeded
+func (limiter *Limiter) TryTake() bool {
+	_, ok := limiter.TryReserve()
+	return ok
+}
+
+// TryReserve takes one token like TryTake and returns its reservation,
+// canceling it gives the token back as long as its window is not over
+func (limiter *Limiter) TryReserve() (*Reservation, bool) {
+	parent := limiter.parent.Load()
+	// don't spend a token of this bucket when the parent can't grant one
+	if parent != nil && !parent.CanTake() {
+		return nil, false
+	}
+	window, ok := limiter.tryTake()
+	if !ok {
+		return nil, false
+	}
+	reservation := newReservation(limiter, window)
+	if parent != nil {
+		parentReservation, ok := parent.TryReserve()
+		if !ok {
+			// the parent drained in the meantime
+			reservation.Cancel()
+			return nil, false
+		}
+		reservation.join(parentReservation)
+	}
+	limiter.touch()
+	return reservation, true
+}
+
+// giveBack puts n tokens taken in window back in this bucket only, they are
+// dropped once the bucket was refilled since
+func (limiter *Limiter) giveBack(window uint64, n uint) {
 	switch limiter.strategy {
 	case LeakyBucket:
-		_ = limiter.leakyBucketLimiter.Wait(context.TODO())
+		// a negative reservation adds tokens, the burst caps them
+		limiter.leakyBucketLimiter.AllowN(time.Now(), -int(min(n, math.MaxInt32)))
+		limiter.dispatch()
 	default:
-		<-limiter.tokens
+		maxCount := limiter.windowLimit(limiter.maxCount.Load())
+		for {
+			count := limiter.count.Load()
+			if limiter.window.Load() != window {
+				// the next refill starts over anyway
+				return
+			}
+			next := count + uint32(min(uint(maxCount-min(count, maxCount)), n))
+			if next == count || limiter.count.CompareAndSwap(count, next) {
+				// waiters only block on an empty bucket
+				if count == 0 && next > 0 {
+					limiter.notify()
+				}
+				return
+			}
+		}
 	}
 }
 
-// CanTake checks if the rate limiter has any token
+// CanTake checks if the rate limiter and its parent if any have tokens
 func (limiter *Limiter) CanTake() bool {
+	if parent := limiter.parent.Load(); parent != nil && !parent.CanTake() {
+		return false
+	}
+	return limiter.canTake()
+}
+
+// SetParent sets the limiter tokens are taken from once this limiter grants one,
+// nil removes the parent
+func (limiter *Limiter) SetParent(parent *Limiter) error {
+	for ancestor := parent; ancestor != nil; ancestor = ancestor.parent.Load() {
+		if ancestor == limiter {
+			return errkit.New("ratelimit: parent cycle detected")
+		}
+	}
+	limiter.parent.Store(parent)
+	return nil
+}
+
+// Parent returns the parent limiter or nil
+func (limiter *Limiter) Parent() *Limiter {
+	return limiter.parent.Load()
+}
+
+// take one token from this bucket only
+func (limiter *Limiter) take() {
+	// Take can't report an error so it isn't bounded by SetMaxQueue and SetMaxWait
+	_, _ = limiter.waitQueued(context.TODO(), PriorityNormal, false)
+}
+
+// tryTake takes one token from this bucket only without waiting and returns the window it belongs to
+func (limiter *Limiter) tryTake() (uint64, bool) {
+	switch limiter.strategy {
+	case LeakyBucket:
+		return 0, limiter.leakyBucketLimiter.Allow()
+	default:
+		for {
+			// a refill in between leaves the token with the previous window so it is not given back
+			window := limiter.window.Load()
+			count := limiter.count.Load()
+			if count == 0 {
+				return 0, false
+			}
+			if limiter.count.CompareAndSwap(count, count-1) {
+				return window, true
+			}
+		}
+	}
+}
+
+// canTake checks if this bucket has any token
+func (limiter *Limiter) canTake() bool {
 	switch limiter.strategy {
 	case LeakyBucket:
-		return limiter.leakyBucketLimiter.Tokens() > 0
+		return limiter.leakyBucketLimiter.Tokens() >= 1
 	default:
 		return limiter.count.Load() > 0
 	}
@@ -76,6 +260,16 @@ func (limiter *Limiter) GetLimit() uint {
 	return uint(limiter.maxCount.Load())
 }
 
+// getDuration returns the current refill interval
+func (limiter *Limiter) getDuration() time.Duration {
+	return time.Duration(limiter.interval.Load())
+}
+
+// touch records a granted token
+func (limiter *Limiter) touch() {
+	limiter.lastUsed.Store(time.Now().UnixNano())
+}
+
 // GetLimit returns current rate limit per given duration
 func (limiter *Limiter) SetLimit(max uint) {
 	limiter.maxCount.Store(uint32(max))
@@ -88,12 +282,80 @@ func (limiter *Limiter) SetLimit(max uint) {
 
 // GetLimit returns current rate limit per given duration
 func (limiter *Limiter) SetDuration(d time.Duration) {
-	limiter.interval = d
+	limiter.interval.Store(int64(d))
 	switch limiter.strategy {
 	case LeakyBucket:
 		limiter.leakyBucketLimiter.SetLimit(rate.Every(d))
 	default:
 		limiter.ticker.Reset(d)
+		limiter.windowStart.Store(time.Now().UnixNano())
+	}
+}
+
+// update reconfigures the limiter in place so that its waiters are preserved, with keepSpent
+// the current window gets the new limit minus the tokens already spent, otherwise a lower limit
+// applies to it as well
+func (limiter *Limiter) update(isUnlimited bool, max uint, duration time.Duration, parent *Limiter, keepSpent bool) error {
+	if err := limiter.SetParent(parent); err != nil {
+		return err
+	}
+	if isUnlimited {
+		max, duration = math.MaxUint32, time.Millisecond
+	}
+	previous := limiter.maxCount.Load()
+	limiter.SetLimit(max)
+	if keepSpent {
+		limiter.resizeWindow(previous)
+	} else {
+		limiter.capWindow()
+	}
+	// resetting the ticker postpones the next refill
+	if duration != limiter.getDuration() {
+		limiter.SetDuration(duration)
+	}
+	if limiter.strategy == LeakyBucket {
+		// the waiters may be served sooner with the new rate
+		limiter.dispatch()
+	}
+	return nil
+}
+
+// capWindow applies a lower limit to the current window as well, a higher one applies from the next refill
+func (limiter *Limiter) capWindow() {
+	if limiter.strategy == LeakyBucket {
+		return
+	}
+	for {
+		count := limiter.count.Load()
+		limit := limiter.windowLimit(limiter.maxCount.Load())
+		if count <= limit || limiter.count.CompareAndSwap(count, limit) {
+			return
+		}
+	}
+}
+
+// resizeWindow gives the current window the new limit minus the tokens spent under the previous one
+func (limiter *Limiter) resizeWindow(previous uint32) {
+	if limiter.strategy == LeakyBucket {
+		return
+	}
+	window := limiter.windowStart.Load()
+	previous, limit := limiter.windowLimit(previous), limiter.windowLimit(limiter.maxCount.Load())
+	for {
+		count := limiter.count.Load()
+		if limiter.windowStart.Load() != window {
+			// the bucket was refilled with the new limit in the meantime
+			return
+		}
+		spent := previous - min(count, previous)
+		next := limit - min(spent, limit)
+		if limiter.count.CompareAndSwap(count, next) {
+			// waiters only block on an empty bucket
+			if count == 0 && next > 0 {
+				limiter.notify()
+			}
+			return
+		}
 	}
 }
 
@@ -116,14 +378,17 @@ func New(ctx context.Context, max uint, duration time.Duration) *Limiter {
 	maxCount.Store(uint32(max))
 	limiter := &Limiter{
 		ticker:     time.NewTicker(duration),
-		tokens:     make(chan struct{}),
+		done:       make(chan struct{}),
 		ctx:        ctx,
 		cancelFunc: cancel,
 		strategy:   None,
-		interval:   duration,
 	}
+	limiter.interval.Store(int64(duration))
 	limiter.maxCount.Store(uint32(max))
 	limiter.count.Store(uint32(max))
+	limiter.windowStart.Store(time.Now().UnixNano())
+	refilled := make(chan struct{})
+	limiter.refilled.Store(&refilled)
 	go limiter.run(internalctx)
 
 	return limiter
@@ -134,12 +399,16 @@ func NewUnlimited(ctx context.Context) *Limiter {
 	internalctx, cancel := context.WithCancel(context.TODO())
 	limiter := &Limiter{
 		ticker:     time.NewTicker(time.Millisecond),
-		tokens:     make(chan struct{}),
+		done:       make(chan struct{}),
 		ctx:        ctx,
 		cancelFunc: cancel,
 	}
+	limiter.interval.Store(int64(time.Millisecond))
 	limiter.maxCount.Store(math.MaxUint32)
 	limiter.count.Store(math.MaxUint32)
+	limiter.windowStart.Store(time.Now().UnixNano())
+	refilled := make(chan struct{})
+	limiter.refilled.Store(&refilled)
 	go limiter.run(internalctx)
 
 	return limiter
@@ -152,6 +421,6 @@ func NewLeakyBucket(ctx context.Context, max uint, duration time.Duration) *Limi
 		leakyBucketLimiter: rate.NewLimiter(rate.Every(duration), int(max)),
 	}
 	limiter.maxCount.Store(uint32(max))
-	limiter.interval = duration
+	limiter.interval.Store(int64(duration))
 	return limiter
 }
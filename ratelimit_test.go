@@ -96,6 +96,75 @@ func TestRateLimit(t *testing.T) {
 		require.False(t, limiter.CanTake())
 	})
 
+	t.Run("Test TryTake and TakeContext", func(t *testing.T) {
+		limiter := New(context.TODO(), 2, time.Hour)
+		defer limiter.Stop()
+
+		require.True(t, limiter.TryTake())
+		require.Nil(t, limiter.TakeContext(context.TODO()))
+		require.False(t, limiter.TryTake())
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, limiter.TakeContext(ctx), context.DeadlineExceeded)
+
+		leaky := NewLeakyBucket(context.TODO(), 1, time.Hour)
+		require.True(t, leaky.TryTake())
+		require.False(t, leaky.TryTake())
+	})
+
+	t.Run("Parent Limiter", func(t *testing.T) {
+		parent := New(context.TODO(), 3, time.Hour)
+		defer parent.Stop()
+		child := New(context.TODO(), 2, time.Hour)
+		defer child.Stop()
+		require.Nil(t, child.SetParent(parent))
+		require.Equal(t, parent, child.Parent())
+
+		child.Take()
+		require.True(t, child.TryTake())
+		// the exhausted child doesn't spend parent tokens
+		require.False(t, child.TryTake())
+		require.False(t, child.CanTake())
+		require.True(t, parent.CanTake())
+
+		// the exhausted parent doesn't spend child tokens
+		other := New(context.TODO(), 2, time.Hour)
+		defer other.Stop()
+		require.Nil(t, other.SetParent(parent))
+		require.True(t, other.TryTake())
+		require.False(t, other.TryTake())
+		require.True(t, other.canTake())
+
+		require.Error(t, parent.SetParent(child))
+	})
+
+	t.Run("Parent Drained Concurrently", func(t *testing.T) {
+		parent := New(context.TODO(), 10, time.Hour)
+		defer parent.Stop()
+		child := New(context.TODO(), 1000, time.Hour)
+		defer child.Stop()
+		require.Nil(t, child.SetParent(parent))
+
+		var granted atomic.Int32
+		var wg sync.WaitGroup
+		for range 16 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 20 {
+					if child.TryTake() {
+						granted.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		// the child only spends the tokens the parent granted
+		require.Equal(t, int32(10), granted.Load())
+		require.Equal(t, uint32(990), child.count.Load())
+	})
+
 	t.Run("LeakyBucket", func(t *testing.T) {
 		limiter := NewLeakyBucket(context.TODO(), 1, time.Second)
 
@@ -109,3 +178,58 @@ func TestRateLimit(t *testing.T) {
 		require.True(t, took >= expected)
 	})
 }
+
+func TestReservation(t *testing.T) {
+	ctx := context.Background()
+	parent := New(ctx, 2, time.Hour)
+	defer parent.Stop()
+	limiter := New(ctx, 2, time.Hour)
+	defer limiter.Stop()
+	require.NoError(t, limiter.SetParent(parent))
+	first, ok := limiter.TryReserve()
+	require.True(t, ok)
+	second, err := limiter.Reserve(ctx)
+	require.NoError(t, err)
+	require.False(t, limiter.CanTake())
+
+	// the canceled tokens go back to the parent too, only once
+	first.Cancel()
+	first.Cancel()
+	require.Equal(t, uint32(1), limiter.count.Load())
+	require.Equal(t, uint32(1), parent.count.Load())
+
+	// a canceled token wakes up the waiters
+	require.True(t, limiter.TryTake())
+	done := make(chan error)
+	go func() {
+		done <- limiter.TakeContext(ctx)
+	}()
+	queued(t, limiter, 1)
+	second.Cancel()
+	require.NoError(t, <-done)
+
+	leaky := NewLeakyBucket(ctx, 2, time.Hour)
+	require.True(t, leaky.TryTake())
+	reservation, ok := leaky.TryReserve()
+	require.True(t, ok)
+	require.False(t, leaky.TryTake())
+	reservation.Cancel()
+	require.True(t, leaky.TryTake())
+	require.False(t, leaky.TryTake())
+}
+
+func TestReservationPreviousWindow(t *testing.T) {
+	limiter := New(context.Background(), 2, 100*time.Millisecond)
+	defer limiter.Stop()
+	old, ok := limiter.TryReserve()
+	require.True(t, ok)
+	require.True(t, limiter.TryTake())
+	window := limiter.window.Load()
+	require.Eventually(t, func() bool { return limiter.window.Load() != window }, time.Second, time.Millisecond)
+	require.True(t, limiter.TryTake())
+	require.True(t, limiter.TryTake())
+
+	// the token of the previous window doesn't add to the current one
+	old.Cancel()
+	require.False(t, limiter.TryTake())
+}
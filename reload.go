@@ -0,0 +1,366 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// Reloadable is a limiter a config can be applied to while in use
+type Reloadable interface {
+	// ApplyConfig reconfigures the limiter built from previous with next in place
+	ApplyConfig(previous, next *Config) error
+}
+
+var (
+	_ Reloadable = (*MultiLimiter)(nil)
+	_ Reloadable = (*AutoLimiter)(nil)
+)
+
+// ReloaderOption is a function that configures the Reloader
+type ReloaderOption func(*Reloader)
+
+// WithReloadInterval sets how often the config file is checked for changes
+func WithReloadInterval(interval time.Duration) ReloaderOption {
+	return func(r *Reloader) {
+		r.interval = interval
+	}
+}
+
+// WithReloadErrorHandler sets the function called when a changed config can't be
+// loaded or applied, the current config stays in use
+func WithReloadErrorHandler(onError func(err error)) ReloaderOption {
+	return func(r *Reloader) {
+		r.onError = onError
+	}
+}
+
+// WithReloadHandler sets the function called after a changed config is applied
+func WithReloadHandler(onReload func(config *Config)) ReloaderOption {
+	return func(r *Reloader) {
+		r.onReload = onReload
+	}
+}
+
+// Reloader polls a config file and applies its changes to a live limiter
+type Reloader struct {
+	path     string
+	target   Reloadable
+	interval time.Duration
+	onError  func(err error)
+	onReload func(config *Config)
+
+	mu      sync.Mutex
+	config  *Config
+	data    []byte
+	modTime time.Time
+	size    int64
+
+	cancelFunc context.CancelFunc
+	done       chan struct{}
+}
+
+// NewReloader watches the config file at path, target must have been built from its current content
+func NewReloader(ctx context.Context, path string, target Reloadable, opts ...ReloaderOption) (*Reloader, error) {
+	r := &Reloader{
+		path:     path,
+		target:   target,
+		interval: 5 * time.Second,
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.interval <= 0 {
+		return nil, ErrZeroDuration
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errkit.Wrapf(err, "config: could not read %v", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errkit.Wrapf(err, "config: could not read %v", path)
+	}
+	if r.config, err = ParseConfig(data); err != nil {
+		return nil, err
+	}
+	r.data, r.modTime, r.size = data, info.ModTime(), info.Size()
+
+	internalctx, cancel := context.WithCancel(ctx)
+	r.cancelFunc = cancel
+	go r.run(internalctx)
+	return r, nil
+}
+
+// Config returns the config in use
+func (r *Reloader) Config() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.config
+}
+
+// Reload checks the config file and applies it if it changed
+func (r *Reloader) Reload() error {
+	config, err := r.reload()
+	if err != nil {
+		return err
+	}
+	if config != nil && r.onReload != nil {
+		r.onReload(config)
+	}
+	return nil
+}
+
+// reload applies the config file and returns it if it changed
+func (r *Reloader) reload() (*Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return nil, errkit.Wrapf(err, "config: could not read %v", r.path)
+	}
+	if info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return nil, nil
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, errkit.Wrapf(err, "config: could not read %v", r.path)
+	}
+	if bytes.Equal(data, r.data) {
+		r.modTime, r.size = info.ModTime(), info.Size()
+		return nil, nil
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	// on failure the file is read and applied again on the next check
+	if err := r.target.ApplyConfig(r.config, config); err != nil {
+		return nil, err
+	}
+	r.config, r.data, r.modTime, r.size = config, data, info.ModTime(), info.Size()
+	return config, nil
+}
+
+// Stop watching the config file
+func (r *Reloader) Stop() {
+	r.cancelFunc()
+	<-r.done
+}
+
+func (r *Reloader) run(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil && r.onError != nil {
+				r.onError(err)
+			}
+		}
+	}
+}
+
+// ApplyConfig reconfigures the limiter built from previous with next in place,
+// next is validated as a whole before any change, the global limit can only be updated
+// and the keys dropped from the config go back to the rules and the defaults
+func (e *AutoLimiter) ApplyConfig(previous, next *Config) error {
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if next.Defaults == nil {
+		return errkit.New("config: defaults are required by AutoLimiter")
+	}
+	parent := e.defaults().Parent
+	if err := checkGlobal(parent, previous, next); err != nil {
+		return err
+	}
+	keys, err := changedKeys(parent, previous, next)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	if err := applyGlobal(parent, previous, next); err != nil {
+		errs = errkit.Append(errs, err)
+	}
+	if !slices.Equal(previous.Rules, next.Rules) || previous.Defaults == nil || *previous.Defaults != *next.Defaults {
+		if err := e.SetRules(next.autoRules(parent)...); err != nil {
+			errs = errkit.Append(errs, err)
+		}
+		if err := e.SetDefaults(append(next.Defaults.autoOptions(), WithParent(parent))...); err != nil {
+			errs = errkit.Append(errs, err)
+		} else if err := e.PropagateDefaults(); err != nil {
+			errs = errkit.Append(errs, err)
+		}
+	}
+	if err := applyKeys(e, previous, next, keys); err != nil {
+		errs = errkit.Append(errs, err)
+	}
+	return errs
+}
+
+// resetKey drops the custom settings of key, its limiter is reconfigured in place
+// with the matching rule or the defaults keeping the tokens spent and the waiters
+func (e *AutoLimiter) resetKey(key string) error {
+	key = e.normalizeKey(key)
+	e.options.Delete(key)
+	limiter, err := e.get(key)
+	if err != nil {
+		// the key is created with the rules and the defaults on its next use
+		return nil
+	}
+	options, err := e.defaultsOf(key)
+	if err != nil {
+		return err
+	}
+	if err := options.validateLimits(); err != nil {
+		return err
+	}
+	return options.configure(limiter, true)
+}
+
+// ApplyConfig reconfigures the limiter built from previous with next in place,
+// next is validated as a whole before any change, the global limit can only be updated
+// and the keys dropped from the config go back to the defaults or are removed without them
+func (m *MultiLimiter) ApplyConfig(previous, next *Config) error {
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if len(next.Rules) > 0 {
+		return errkit.New("config: rules are only supported by AutoLimiter")
+	}
+	parent := m.configParent()
+	if err := checkGlobal(parent, previous, next); err != nil {
+		return err
+	}
+	keys, err := changedKeys(parent, previous, next)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	if err := applyGlobal(parent, previous, next); err != nil {
+		errs = errkit.Append(errs, err)
+	}
+	switch {
+	case next.Defaults == nil:
+		m.defaults.Store(nil)
+	case previous.Defaults == nil || *previous.Defaults != *next.Defaults:
+		defaults := next.Defaults.options("")
+		defaults.Parent = parent
+		if err := m.SetDefaults(defaults); err != nil {
+			errs = errkit.Append(errs, fieldError("defaults", err))
+		} else if err := m.refresh(); err != nil {
+			errs = errkit.Append(errs, err)
+		}
+	}
+	if err := applyKeys(m, previous, next, keys); err != nil {
+		errs = errkit.Append(errs, err)
+	}
+	return errs
+}
+
+// resetKey drops the options of key, its limiter is reconfigured in place with the
+// defaults keeping the tokens spent and the waiters, without defaults it is removed
+func (m *MultiLimiter) resetKey(key string) error {
+	defaults := m.defaults.Load()
+	if defaults == nil {
+		m.Remove(key)
+		return nil
+	}
+	key = m.normalizeKey(key)
+	m.options.Delete(key)
+	if limiter, ok := m.limiters.Load(key); ok {
+		return defaults.configure(limiter.(*Limiter), true)
+	}
+	return nil
+}
+
+// keyConfigurer is a keyed limiter whose keys can be reconfigured from a config
+type keyConfigurer interface {
+	// configureKey updates the key of opts or adds it if missing
+	configureKey(opts *Options) error
+	// resetKey drops the custom options of key
+	resetKey(key string) error
+}
+
+// changedKeys returns the validated options of the keys of next added or changed since previous,
+// parent is the global limiter shared by all the keys
+func changedKeys(parent *Limiter, previous, next *Config) (map[string]*Options, error) {
+	keys := make(map[string]*Options)
+	for key, limit := range next.Keys {
+		if current, ok := previous.Keys[key]; ok && current == limit {
+			continue
+		}
+		opts := limit.options(key)
+		opts.Parent = parent
+		if err := opts.Validate(); err != nil {
+			return nil, fieldError("keys."+key, err)
+		}
+		keys[key] = opts
+	}
+	return keys, nil
+}
+
+// applyKeys resets the keys dropped from previous and configures the changed keys of next
+func applyKeys(target keyConfigurer, previous, next *Config, keys map[string]*Options) error {
+	var errs error
+	for key := range previous.Keys {
+		if _, ok := next.Keys[key]; !ok {
+			if err := target.resetKey(key); err != nil {
+				errs = errkit.Append(errs, fieldError("keys."+key, err))
+			}
+		}
+	}
+	for key, opts := range keys {
+		if err := target.configureKey(opts); err != nil {
+			errs = errkit.Append(errs, fieldError("keys."+key, err))
+		}
+	}
+	return errs
+}
+
+// checkGlobal checks that the global limit of next can be applied to the limiter built from previous
+func checkGlobal(parent *Limiter, previous, next *Config) error {
+	if previous.Strategy != next.Strategy {
+		return errkit.New("config: strategy: can't be changed on a live limiter")
+	}
+	if (previous.Global == nil) != (next.Global == nil) {
+		return errkit.New("config: global: can't be added or removed on a live limiter")
+	}
+	if next.Global == nil || *previous.Global == *next.Global {
+		return nil
+	}
+	if parent == nil {
+		return errkit.New("config: global: limiter not found")
+	}
+	// an unlimited global is never a leaky bucket
+	if next.Strategy == LeakyBucket && previous.Global.Unlimited != next.Global.Unlimited {
+		return errkit.New("config: global: can't switch between unlimited and a leaky bucket on a live limiter")
+	}
+	return nil
+}
+
+// applyGlobal updates the global limiter in place, the change must have been checked
+func applyGlobal(parent *Limiter, previous, next *Config) error {
+	if next.Global == nil || *previous.Global == *next.Global {
+		return nil
+	}
+	r := next.globalRate()
+	duration := r.Duration
+	if parent.strategy == LeakyBucket && !r.Unlimited {
+		// the leaky bucket grants a token every duration
+		duration /= time.Duration(r.MaxCount)
+	}
+	return parent.update(r.Unlimited, r.MaxCount, duration, parent.Parent(), true)
+}
@@ -0,0 +1,232 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+// writeConfig writes data to path moving its modification time forward
+func writeConfig(t *testing.T, path, data string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	modTime := time.Now().Add(time.Duration(len(data)) * time.Second)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestReloaderAutoLimiter(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `
+global: {max_count: 100, duration: 1h}
+defaults: {max_count: 10, duration: 1h}
+keys:
+  a: {max_count: 1, duration: 1h}
+  b: {max_count: 2, duration: 1h}
+`)
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	limiter, err := config.NewAutoLimiter(ctx)
+	require.NoError(t, err)
+	defer limiter.Stop()
+	require.NoError(t, limiter.Take("auto"))
+	require.NoError(t, limiter.Take("b"))
+	b, err := limiter.get("b")
+	require.NoError(t, err)
+
+	reloader, err := NewReloader(ctx, path, limiter, WithReloadInterval(time.Hour))
+	require.NoError(t, err)
+	defer reloader.Stop()
+
+	writeConfig(t, path, `
+global: {max_count: 50, duration: 1h}
+defaults: {max_count: 20, duration: 1h}
+keys:
+  a: {max_count: 3, duration: 1h}
+  c: {max_count: 4, duration: 1h}
+rules:
+  - {type: suffix, pattern: .gov, max_count: 5, duration: 1h}
+`)
+	require.NoError(t, reloader.Reload())
+	for key, expected := range map[string]uint{"a": 3, "b": 20, "c": 4, "auto": 20, "www.nasa.gov": 5} {
+		limit, err := limiter.GetLimit(key)
+		require.NoError(t, err)
+		require.Equal(t, expected, limit, key)
+	}
+	require.Equal(t, uint(50), limiter.defaults().Parent.GetLimit())
+	// the tokens spent before the reload still count
+	info, err := limiter.Info("auto")
+	require.NoError(t, err)
+	require.False(t, info.LastUsed.IsZero())
+	auto, err := limiter.get("auto")
+	require.NoError(t, err)
+	require.Equal(t, uint32(19), auto.count.Load())
+	// a key dropped from the config is reconfigured in place with the defaults
+	info, err = limiter.Info("b")
+	require.NoError(t, err)
+	require.Equal(t, OriginDefault, info.Origin)
+	dropped, err := limiter.get("b")
+	require.NoError(t, err)
+	require.Same(t, b, dropped)
+	require.Equal(t, uint32(19), b.count.Load())
+
+	// invalid configs are reported and the current one stays in use
+	writeConfig(t, path, `defaults: {max_count: 0, duration: 1h}`)
+	require.ErrorContains(t, reloader.Reload(), "defaults.max_count")
+	writeConfig(t, path, `defaults: {max_count: 1, duration: 1h}`)
+	require.ErrorContains(t, reloader.Reload(), "global")
+	limit, err := limiter.GetLimit("a")
+	require.NoError(t, err)
+	require.Equal(t, uint(3), limit)
+	require.Equal(t, uint(20), reloader.Config().Defaults.MaxCount)
+}
+
+func TestReloaderMultiLimiter(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, `{"keys": {"a": {"max_count": 1, "duration": "1h"}}}`)
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	limiter, err := config.NewMultiLimiter(ctx)
+	require.NoError(t, err)
+	defer limiter.Stop()
+
+	reloaded := make(chan *Config, 1)
+	errs := make(chan error, 1)
+	reloader, err := NewReloader(ctx, path, limiter,
+		WithReloadInterval(10*time.Millisecond),
+		WithReloadHandler(func(config *Config) { reloaded <- config }),
+		WithReloadErrorHandler(func(err error) {
+			// the error is reported on every check
+			select {
+			case errs <- err:
+			default:
+			}
+		}),
+	)
+	require.NoError(t, err)
+	defer reloader.Stop()
+
+	writeConfig(t, path, `{"defaults": {"max_count": 7, "duration": "1h"}, "keys": {"a": {"max_count": 2, "duration": "1h"}}}`)
+	select {
+	case config := <-reloaded:
+		require.Equal(t, uint(7), config.Defaults.MaxCount)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "config not reloaded")
+	}
+	limit, err := limiter.GetLimit("a")
+	require.NoError(t, err)
+	require.Equal(t, uint(2), limit)
+	limit, err = limiter.GetLimit("other")
+	require.NoError(t, err)
+	require.Equal(t, uint(7), limit)
+	a, err := limiter.get("a")
+	require.NoError(t, err)
+
+	writeConfig(t, path, `{"defaults": {"max_count": 7, "duration": "1h"}}`)
+	select {
+	case config := <-reloaded:
+		require.Empty(t, config.Keys)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "config not reloaded")
+	}
+	// a key dropped from the config is reconfigured in place with the defaults
+	info, err := limiter.Info("a")
+	require.NoError(t, err)
+	require.Equal(t, OriginDefault, info.Origin)
+	dropped, err := limiter.get("a")
+	require.NoError(t, err)
+	require.Same(t, a, dropped)
+	require.Equal(t, uint(7), dropped.GetLimit())
+
+	writeConfig(t, path, `{"rules": [{"type": "exact", "pattern": "a", "unlimited": true}]}`)
+	select {
+	case err := <-errs:
+		require.ErrorContains(t, err, "rules")
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "error not reported")
+	}
+}
+
+func TestReloaderLeakyGlobal(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `
+strategy: leaky-bucket
+global: {max_count: 10, duration: 1s}
+defaults: {max_count: 10, duration: 1h}
+`)
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	limiter, err := config.NewAutoLimiter(ctx)
+	require.NoError(t, err)
+	defer limiter.Stop()
+	reloader, err := NewReloader(ctx, path, limiter, WithReloadInterval(time.Hour))
+	require.NoError(t, err)
+	defer reloader.Stop()
+
+	// nothing is applied when a part of the config can't be
+	writeConfig(t, path, `
+global: {max_count: 20, duration: 1s}
+defaults: {max_count: 5, duration: 1h}
+`)
+	require.ErrorContains(t, reloader.Reload(), "strategy")
+	global := limiter.defaults().Parent
+	require.Equal(t, uint(10), global.GetLimit())
+	require.Equal(t, uint(10), limiter.defaults().MaxCount)
+
+	// the global limit keeps spreading max_count tokens over the duration
+	writeConfig(t, path, `
+strategy: leaky-bucket
+global: {max_count: 20, duration: 1s}
+defaults: {max_count: 10, duration: 1h}
+`)
+	require.NoError(t, reloader.Reload())
+	require.Equal(t, uint(20), global.GetLimit())
+	require.Equal(t, rate.Every(50*time.Millisecond), global.leakyBucketLimiter.Limit())
+
+	// a leaky global can't become unlimited in place
+	writeConfig(t, path, `
+strategy: leaky-bucket
+global: {unlimited: true}
+defaults: {max_count: 10, duration: 1h}
+`)
+	require.ErrorContains(t, reloader.Reload(), "unlimited")
+	require.Equal(t, uint(20), global.GetLimit())
+}
+
+func TestReloaderUnlimitedLeakyGlobal(t *testing.T) {
+	ctx := context.Background()
+	previous, err := ParseConfig([]byte(`
+strategy: leaky-bucket
+global: {unlimited: true}
+defaults: {max_count: 10, duration: 1h}
+`))
+	require.NoError(t, err)
+	limiter, err := previous.NewAutoLimiter(ctx)
+	require.NoError(t, err)
+	defer limiter.Stop()
+	global := limiter.defaults().Parent
+	require.Equal(t, None, global.strategy)
+
+	// the unlimited global is not a leaky bucket so it can't become one
+	next, err := ParseConfig([]byte(`
+strategy: leaky-bucket
+global: {max_count: 10, duration: 1s}
+defaults: {max_count: 10, duration: 1h}
+`))
+	require.NoError(t, err)
+	require.ErrorContains(t, limiter.ApplyConfig(previous, next), "unlimited")
+	require.Equal(t, time.Millisecond, global.getDuration())
+
+	// while a global with the default strategy is resized with the rate semantics
+	previous.Strategy, next.Strategy = None, None
+	require.NoError(t, limiter.ApplyConfig(previous, next))
+	require.Equal(t, uint(10), global.GetLimit())
+	require.Equal(t, time.Second, global.getDuration())
+}
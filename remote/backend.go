@@ -0,0 +1,84 @@
+package remote
+
+import (
+	"context"
+	"errors"
+
+	"github.com/projectdiscovery/ratelimit"
+)
+
+// Backend is the keyed limiter served by the handler
+type Backend interface {
+	TakeContext(ctx context.Context, key string) error
+	TryTake(key string) (bool, error)
+	CanTake(key string) bool
+	GetLimit(key string) (uint, error)
+	// Add adds a key with the given options, it fails if the key exists
+	Add(opts *ratelimit.Options) error
+	// Update updates the options of a key in place, it fails if the key is missing
+	Update(opts *ratelimit.Options) error
+	// Configure adds a key or updates its options in place
+	Configure(opts *ratelimit.Options) error
+}
+
+// multiBackend serves a ratelimit.MultiLimiter
+type multiBackend struct {
+	*ratelimit.MultiLimiter
+}
+
+// Configure adds a key or updates its options in place
+func (m multiBackend) Configure(opts *ratelimit.Options) error {
+	return configure(m.Update, m.Add, opts)
+}
+
+// NewMultiLimiterBackend returns a backend serving a MultiLimiter
+func NewMultiLimiterBackend(limiter *ratelimit.MultiLimiter) Backend {
+	return multiBackend{MultiLimiter: limiter}
+}
+
+// autoBackend serves a ratelimit.AutoLimiter
+type autoBackend struct {
+	*ratelimit.AutoLimiter
+}
+
+// Add adds a key with the given options, it fails if the key exists
+func (a autoBackend) Add(opts *ratelimit.Options) error {
+	return a.AutoLimiter.Add(opts.Key, autoOptions(opts)...)
+}
+
+// Update updates the options of a key in place, it fails if the key is missing
+func (a autoBackend) Update(opts *ratelimit.Options) error {
+	return a.AutoLimiter.Update(opts.Key, autoOptions(opts)...)
+}
+
+// Configure adds a key or updates its options in place
+func (a autoBackend) Configure(opts *ratelimit.Options) error {
+	return configure(a.Update, a.Add, opts)
+}
+
+// configure updates the key of opts with update or adds it with add if missing
+func configure(update, add func(opts *ratelimit.Options) error, opts *ratelimit.Options) error {
+	for {
+		err := update(opts)
+		if !errors.Is(err, ratelimit.ErrKeyMissing) {
+			return err
+		}
+		// the key may be added concurrently
+		if err := add(opts); !errors.Is(err, ratelimit.ErrKeyAlreadyExists) {
+			return err
+		}
+	}
+}
+
+// autoOptions converts the options of a key to AutoLimiter options
+func autoOptions(opts *ratelimit.Options) []ratelimit.AutoLimiterOption {
+	if opts.IsUnlimited {
+		return []ratelimit.AutoLimiterOption{ratelimit.WithUnlimited()}
+	}
+	return []ratelimit.AutoLimiterOption{ratelimit.WithMaxCount(opts.MaxCount), ratelimit.WithDuration(opts.Duration)}
+}
+
+// NewAutoLimiterBackend returns a backend serving an AutoLimiter
+func NewAutoLimiterBackend(limiter *ratelimit.AutoLimiter) Backend {
+	return autoBackend{AutoLimiter: limiter}
+}
@@ -0,0 +1,171 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// ClientOption is a function that configures the Client
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the http client used to reach the server
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// Client is a keyed limiter backed by a remote server,
+// it has the same methods as the local keyed limiters
+type Client struct {
+	ctx        context.Context
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the server at baseURL
+func NewClient(ctx context.Context, baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		ctx:        ctx,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Add new key on the server
+func (c *Client) Add(opts *ratelimit.Options) error {
+	return c.configure(opts, http.Header{"If-None-Match": {"*"}})
+}
+
+// Update the options of an existing key on the server, it returns ErrKeyMissing
+// if the key is not present like the local keyed limiters
+func (c *Client) Update(opts *ratelimit.Options) error {
+	return c.configure(opts, http.Header{"If-Match": {"*"}})
+}
+
+// Configure updates the options of a key on the server adding it if needed
+func (c *Client) Configure(opts *ratelimit.Options) error {
+	return c.configure(opts, nil)
+}
+
+// configure sends the options of a key with the given headers
+func (c *Client) configure(opts *ratelimit.Options, header http.Header) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	req := configureRequest{MaxCount: opts.MaxCount, Unlimited: opts.IsUnlimited}
+	if opts.Duration > 0 {
+		req.Duration = opts.Duration.String()
+	}
+	return c.do(c.ctx, http.MethodPut, header, "/v1/keys/"+url.PathEscape(opts.Key), req, nil)
+}
+
+// GetLimit returns current ratelimit of given key
+func (c *Client) GetLimit(key string) (uint, error) {
+	var stats statsResponse
+	if err := c.do(c.ctx, http.MethodGet, nil, "/v1/keys/"+url.PathEscape(key), nil, &stats); err != nil {
+		return 0, err
+	}
+	return stats.Limit, nil
+}
+
+// Take one token from bucket returns error if key not present
+func (c *Client) Take(key string) error {
+	return c.TakeContext(c.ctx, key)
+}
+
+// TakeContext takes one token from bucket or returns error if key not present,
+// the context is done before a token is available or the server can't be reached
+func (c *Client) TakeContext(ctx context.Context, key string) error {
+	return c.do(ctx, http.MethodPost, nil, "/v1/take", takeRequest{Key: key}, nil)
+}
+
+// TryTake takes one token from bucket without waiting and reports whether it succeeded
+func (c *Client) TryTake(key string) (bool, error) {
+	var resp takeResponse
+	if err := c.do(c.ctx, http.MethodPost, nil, "/v1/try-take", takeRequest{Key: key}, &resp); err != nil {
+		return false, err
+	}
+	return resp.Granted, nil
+}
+
+// Reserve takes one token waiting at most maxWait and reports whether it succeeded
+func (c *Client) Reserve(ctx context.Context, key string, maxWait time.Duration) (bool, error) {
+	var resp takeResponse
+	if err := c.do(ctx, http.MethodPost, nil, "/v1/reserve", takeRequest{Key: key, MaxWait: maxWait.String()}, &resp); err != nil {
+		return false, err
+	}
+	return resp.Granted, nil
+}
+
+// CanTake checks if the rate limiter with the given key has any token
+func (c *Client) CanTake(key string) bool {
+	var stats statsResponse
+	if err := c.do(c.ctx, http.MethodGet, nil, "/v1/keys/"+url.PathEscape(key), nil, &stats); err != nil {
+		return false
+	}
+	return stats.CanTake
+}
+
+// Stop is a no-op kept for parity with the local limiters, the server owns the limiters
+func (c *Client) Stop(keys ...string) {}
+
+// do sends a json request and decodes the response into out if any
+func (c *Client) do(ctx context.Context, method string, header http.Header, path string, in, out any) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errkit.Wrap(err, "remote: request failed")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusBadRequest {
+		var errResp errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return errkit.Wrapf(ratelimit.ErrKeyMissing, "remote: %v", errResp.Error)
+		case http.StatusConflict:
+			return errkit.Wrapf(ratelimit.ErrKeyAlreadyExists, "remote: %v", errResp.Error)
+		case http.StatusTooManyRequests:
+			return errkit.Wrapf(ratelimit.ErrQueueFull, "remote: %v", errResp.Error)
+		case http.StatusRequestTimeout:
+			return errkit.Wrapf(ratelimit.ErrWaitTimeout, "remote: %v", errResp.Error)
+		default:
+			return errkit.Newf("remote: server returned %v: %v", resp.StatusCode, errResp.Error)
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,206 @@
+// Package remote exposes keyed limiters over http/json and provides
+// a client with the same interface as the local limiters
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+)
+
+// takeRequest is the body of the take, try-take and reserve endpoints
+type takeRequest struct {
+	Key string `json:"key"`
+	// MaxWait bounds the wait of the reserve endpoint, i.e., 500ms
+	MaxWait string `json:"max_wait,omitempty"`
+}
+
+// takeResponse reports whether a token was granted
+type takeResponse struct {
+	Granted bool `json:"granted"`
+}
+
+// statsResponse describes the state of a key
+type statsResponse struct {
+	Key     string `json:"key"`
+	Limit   uint   `json:"limit"`
+	CanTake bool   `json:"can_take"`
+}
+
+// configureRequest is the body of the configure endpoint
+type configureRequest struct {
+	MaxCount  uint   `json:"max_count,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+	Unlimited bool   `json:"unlimited,omitempty"`
+}
+
+// errorResponse is returned with every non 2xx status
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler serves a Backend over http/json
+type Handler struct {
+	backend Backend
+	mux     *http.ServeMux
+}
+
+// NewHandler creates a handler serving backend
+func NewHandler(backend Backend) *Handler {
+	h := &Handler{backend: backend, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /v1/take", h.take)
+	h.mux.HandleFunc("POST /v1/try-take", h.tryTake)
+	h.mux.HandleFunc("POST /v1/reserve", h.reserve)
+	h.mux.HandleFunc("GET /v1/keys/{key}", h.stats)
+	h.mux.HandleFunc("PUT /v1/keys/{key}", h.configure)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// take waits for a token until the request is done
+func (h *Handler) take(w http.ResponseWriter, r *http.Request) {
+	var req takeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := h.backend.TakeContext(r.Context(), req.Key); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, takeResponse{Granted: true})
+}
+
+// tryTake takes a token without waiting
+func (h *Handler) tryTake(w http.ResponseWriter, r *http.Request) {
+	var req takeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	granted, err := h.backend.TryTake(req.Key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, takeResponse{Granted: granted})
+}
+
+// reserve waits for a token at most max_wait
+func (h *Handler) reserve(w http.ResponseWriter, r *http.Request) {
+	var req takeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	maxWait, err := time.ParseDuration(req.MaxWait)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid max_wait: " + err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), maxWait)
+	defer cancel()
+	err = h.backend.TakeContext(ctx, req.Key)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, takeResponse{Granted: true})
+	case errors.Is(err, context.DeadlineExceeded) && r.Context().Err() == nil, errors.Is(err, ratelimit.ErrWaitTimeout):
+		writeJSON(w, http.StatusOK, takeResponse{Granted: false})
+	default:
+		writeError(w, err)
+	}
+}
+
+// stats describes a key
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	h.writeStats(w, http.StatusOK, r.PathValue("key"))
+}
+
+// configure adds a key or updates its options in place, the conditional
+// headers restrict it to one or the other
+func (h *Handler) configure(w http.ResponseWriter, r *http.Request) {
+	var req configureRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	opts := &ratelimit.Options{Key: r.PathValue("key"), MaxCount: req.MaxCount, IsUnlimited: req.Unlimited}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid duration: " + err.Error()})
+			return
+		}
+		opts.Duration = duration
+	}
+	if err := opts.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	// If-None-Match: * only creates the key
+	if r.Header.Get("If-None-Match") == "*" {
+		if err := h.backend.Add(opts); err != nil {
+			writeError(w, err)
+			return
+		}
+		h.writeStats(w, http.StatusCreated, opts.Key)
+		return
+	}
+	configure := h.backend.Configure
+	// If-Match: * only updates an existing key
+	if r.Header.Get("If-Match") == "*" {
+		configure = h.backend.Update
+	}
+	if err := configure(opts); err != nil {
+		writeError(w, err)
+		return
+	}
+	h.writeStats(w, http.StatusOK, opts.Key)
+}
+
+// writeStats writes the description of key
+func (h *Handler) writeStats(w http.ResponseWriter, status int, key string) {
+	limit, err := h.backend.GetLimit(key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, status, statsResponse{Key: key, Limit: limit, CanTake: h.backend.CanTake(key)})
+}
+
+// decode the request body into v writing an error response on failure
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// writeError maps limiter errors to status codes
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ratelimit.ErrKeyMissing):
+		status = http.StatusNotFound
+	case errors.Is(err, ratelimit.ErrKeyAlreadyExists):
+		status = http.StatusConflict
+	case errors.Is(err, ratelimit.ErrQueueFull):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ratelimit.ErrWaitTimeout):
+		status = http.StatusRequestTimeout
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusRequestTimeout
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,138 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/projectdiscovery/ratelimit/remote"
+	"github.com/stretchr/testify/require"
+)
+
+var _ ratelimit.KeyedLimiter = (*remote.Client)(nil)
+
+func TestMultiLimiterBackend(t *testing.T) {
+	local, err := ratelimit.NewMultiLimiter(context.Background(), &ratelimit.Options{
+		Key:      "default",
+		MaxCount: 2,
+		Duration: time.Hour,
+	})
+	require.Nil(t, err)
+	defer local.Stop()
+	server := httptest.NewServer(remote.NewHandler(remote.NewMultiLimiterBackend(local)))
+	defer server.Close()
+
+	var client ratelimit.KeyedLimiter = remote.NewClient(context.Background(), server.URL, remote.WithHTTPClient(server.Client()))
+
+	limit, err := client.GetLimit("default")
+	require.Nil(t, err)
+	require.Equal(t, uint(2), limit)
+
+	require.Nil(t, client.Take("default"))
+	ok, err := client.TryTake("default")
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.False(t, client.CanTake("default"))
+	ok, err = client.TryTake("default")
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, client.TakeContext(ctx, "default"), context.DeadlineExceeded)
+
+	_, err = client.TryTake("missing")
+	require.True(t, errors.Is(err, ratelimit.ErrKeyMissing))
+	_, err = client.GetLimit("missing")
+	require.True(t, errors.Is(err, ratelimit.ErrKeyMissing))
+
+	remoteClient := client.(*remote.Client)
+	require.Nil(t, remoteClient.Update(&ratelimit.Options{Key: "default", MaxCount: 3, Duration: time.Hour}))
+	require.True(t, errors.Is(remoteClient.Add(&ratelimit.Options{Key: "default", MaxCount: 3, Duration: time.Hour}), ratelimit.ErrKeyAlreadyExists))
+	require.True(t, errors.Is(remoteClient.Update(&ratelimit.Options{Key: "missing", MaxCount: 3, Duration: time.Hour}), ratelimit.ErrKeyMissing))
+	limit, err = client.GetLimit("default")
+	require.Nil(t, err)
+	require.Equal(t, uint(3), limit)
+}
+
+func TestAutoLimiterBackend(t *testing.T) {
+	local := ratelimit.NewAutoLimiter(context.Background(), ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour))
+	defer local.Stop()
+	server := httptest.NewServer(remote.NewHandler(remote.NewAutoLimiterBackend(local)))
+	defer server.Close()
+	client := remote.NewClient(context.Background(), server.URL)
+
+	require.Nil(t, client.Add(&ratelimit.Options{Key: "custom/key", MaxCount: 3, Duration: time.Hour}))
+	err := client.Add(&ratelimit.Options{Key: "custom/key", MaxCount: 3, Duration: time.Hour})
+	require.True(t, errors.Is(err, ratelimit.ErrKeyAlreadyExists))
+	require.Nil(t, client.Add(&ratelimit.Options{Key: "unlimited", IsUnlimited: true}))
+
+	limit, err := client.GetLimit("custom/key")
+	require.Nil(t, err)
+	require.Equal(t, uint(3), limit)
+	// existing keys are reconfigured in place, missing ones are only added by Configure
+	require.Nil(t, client.Update(&ratelimit.Options{Key: "custom/key", MaxCount: 5, Duration: time.Hour}))
+	limit, err = client.GetLimit("custom/key")
+	require.Nil(t, err)
+	require.Equal(t, uint(5), limit)
+	err = client.Update(&ratelimit.Options{Key: "updated", MaxCount: 4, Duration: time.Hour})
+	require.True(t, errors.Is(err, ratelimit.ErrKeyMissing))
+	require.Nil(t, client.Configure(&ratelimit.Options{Key: "updated", MaxCount: 4, Duration: time.Hour}))
+	limit, err = client.GetLimit("updated")
+	require.Nil(t, err)
+	require.Equal(t, uint(4), limit)
+
+	// unknown keys are created with the defaults
+	ok, err := client.Reserve(context.Background(), "auto", time.Second)
+	require.Nil(t, err)
+	require.True(t, ok)
+	ok, err = client.Reserve(context.Background(), "auto", 50*time.Millisecond)
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	for i := 0; i < 10; i++ {
+		require.Nil(t, client.Take("unlimited"))
+	}
+}
+
+func TestHandlerValidation(t *testing.T) {
+	local := ratelimit.NewAutoLimiter(context.Background(), ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour))
+	defer local.Stop()
+	server := httptest.NewServer(remote.NewHandler(remote.NewAutoLimiterBackend(local)))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/v1/take", "{"},
+		{http.MethodPost, "/v1/reserve", `{"key":"a","max_wait":"soon"}`},
+		{http.MethodPut, "/v1/keys/a", `{"max_count":0,"duration":"1s"}`},
+		{http.MethodPut, "/v1/keys/a", `{"max_count":1,"duration":"often"}`},
+	} {
+		req, err := http.NewRequest(tc.method, server.URL+tc.path, strings.NewReader(tc.body))
+		require.Nil(t, err)
+		resp, err := server.Client().Do(req)
+		require.Nil(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, tc.path+" "+tc.body)
+	}
+}
+
+func TestBoundedWaitBackend(t *testing.T) {
+	local := ratelimit.NewAutoLimiter(context.Background(), ratelimit.WithMaxCount(1), ratelimit.WithDuration(time.Hour), ratelimit.WithMaxWait(time.Minute))
+	defer local.Stop()
+	server := httptest.NewServer(remote.NewHandler(remote.NewAutoLimiterBackend(local)))
+	defer server.Close()
+	client := remote.NewClient(context.Background(), server.URL)
+
+	require.Nil(t, client.Take("key"))
+	require.ErrorIs(t, client.Take("key"), ratelimit.ErrWaitTimeout)
+	ok, err := client.Reserve(context.Background(), "key", time.Hour)
+	require.Nil(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// noWindow is the window of a token granted by a stopped limiter, it is never given back
+const noWindow = math.MaxUint64
+
+// stamp is a token taken from a limiter in a window
+type stamp struct {
+	limiter *Limiter
+	window  uint64
+}
+
+// Reservation is a token taken from one or more limiters, canceling it gives the token
+// back to each of them as long as the window it was taken in is not over
+type Reservation struct {
+	stamps   []stamp
+	canceled atomic.Bool
+}
+
+// newReservation returns the reservation of the token taken from limiter in window
+func newReservation(limiter *Limiter, window uint64) *Reservation {
+	return &Reservation{stamps: []stamp{{limiter: limiter, window: window}}}
+}
+
+// join adds the tokens of other to the reservation
+func (r *Reservation) join(other *Reservation) {
+	if other != nil {
+		r.stamps = append(r.stamps, other.stamps...)
+	}
+}
+
+// Cancel gives the token back to the limiters it was taken from, the tokens of a window
+// that is over are dropped since the refill starts over anyway, only the first call counts
+func (r *Reservation) Cancel() {
+	if r == nil || r.canceled.Swap(true) {
+		return
+	}
+	for _, s := range r.stamps {
+		s.limiter.giveBack(s.window, 1)
+	}
+}
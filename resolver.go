@@ -0,0 +1,223 @@
+package ratelimit
+
+import (
+	"context"
+	"maps"
+	"net"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// ResolveFunc resolves name using the upstream resolver at the given address
+type ResolveFunc func(ctx context.Context, upstream, name string) ([]string, error)
+
+// LookupFunc resolves name with an existing resolver of a single upstream
+type LookupFunc func(ctx context.Context, name string) ([]string, error)
+
+// ResolverOption is a function that configures the Resolver
+type ResolverOption func(*Resolver)
+
+// WithResolveFunc sets the function used to send queries to the upstreams
+func WithResolveFunc(resolve ResolveFunc) ResolverOption {
+	return func(r *Resolver) {
+		r.resolve = resolve
+	}
+}
+
+// WithLookupFuncs sets the existing resolve function of each upstream, keys are the upstream
+// addresses, the upstreams passed to NewResolver default to the keys when empty
+func WithLookupFuncs(lookups map[string]LookupFunc) ResolverOption {
+	return func(r *Resolver) {
+		r.lookups = make(map[string]LookupFunc, len(lookups))
+		for upstream, lookup := range lookups {
+			r.lookups[withDefaultPort(upstream)] = lookup
+		}
+	}
+}
+
+// WithNetResolvers sets the *net.Resolver of each upstream, keys are the upstream
+// addresses, the upstreams passed to NewResolver default to the keys when empty
+func WithNetResolvers(resolvers map[string]*net.Resolver) ResolverOption {
+	lookups := make(map[string]LookupFunc, len(resolvers))
+	for upstream, resolver := range resolvers {
+		lookups[upstream] = resolver.LookupHost
+	}
+	return WithLookupFuncs(lookups)
+}
+
+// WithGlobalLimiter sets a limiter shared by all the upstreams
+func WithGlobalLimiter(limiter RateLimiter) ResolverOption {
+	return func(r *Resolver) {
+		r.globalLimiter = limiter
+	}
+}
+
+// WithUpstreamLimiter replaces the per upstream limiter, keys are the upstream addresses
+// with the port, i.e., 1.1.1.1:53
+func WithUpstreamLimiter(limiter KeyedLimiter) ResolverOption {
+	return func(r *Resolver) {
+		r.upstreamLimiter = limiter
+	}
+}
+
+// Resolver distributes queries across rate limited upstream resolvers
+type Resolver struct {
+	upstreams       []string
+	resolve         ResolveFunc
+	lookups         map[string]LookupFunc
+	upstreamLimiter KeyedLimiter
+	globalLimiter   RateLimiter
+	// ownsUpstream is set when the upstream limiter was created by the resolver
+	ownsUpstream bool
+	next         atomic.Uint32
+}
+
+// NewResolver creates a resolver allowing max queries per duration to each upstream
+func NewResolver(ctx context.Context, upstreams []string, max uint, duration time.Duration, opts ...ResolverOption) (*Resolver, error) {
+	r := &Resolver{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if len(upstreams) == 0 {
+		upstreams = slices.Sorted(maps.Keys(r.lookups))
+	}
+	if len(upstreams) == 0 {
+		return nil, errkit.New("resolver: no upstreams provided")
+	}
+	r.upstreams = make([]string, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		r.upstreams = append(r.upstreams, withDefaultPort(upstream))
+	}
+	if r.lookups != nil {
+		if r.resolve != nil {
+			return nil, errkit.New("resolver: both a resolve function and per upstream resolvers set")
+		}
+		for _, upstream := range r.upstreams {
+			if r.lookups[upstream] == nil {
+				return nil, errkit.Newf("resolver: no resolver for upstream %v", upstream)
+			}
+		}
+		r.resolve = r.lookup
+	}
+	if r.upstreamLimiter == nil {
+		if max == 0 || duration == 0 {
+			return nil, errkit.New("resolver: upstream rate not set")
+		}
+		r.upstreamLimiter = NewAutoLimiter(ctx, WithMaxCount(max), WithDuration(duration))
+		r.ownsUpstream = true
+	}
+	if r.resolve == nil {
+		r.resolve = NetResolveFunc(r.upstreams...)
+	}
+	return r, nil
+}
+
+// Resolve name using an upstream that still has budget, it only waits
+// when all the upstreams are exhausted
+func (r *Resolver) Resolve(ctx context.Context, name string) ([]string, error) {
+	upstream, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.resolve(ctx, upstream, name)
+}
+
+// lookup resolves name with the resolver of the upstream
+func (r *Resolver) lookup(ctx context.Context, upstream, name string) ([]string, error) {
+	return r.lookups[upstream](ctx, name)
+}
+
+// Stop the internal limiters, the ones given with the options are left running
+func (r *Resolver) Stop() {
+	if r.ownsUpstream {
+		r.upstreamLimiter.Stop()
+	}
+}
+
+// acquire takes a token for an upstream and the global limiter if any
+func (r *Resolver) acquire(ctx context.Context) (string, error) {
+	start := int(r.next.Add(1) - 1)
+	upstream := ""
+	var reservation *Reservation
+	for i := range r.upstreams {
+		candidate := r.upstreams[(start+i)%len(r.upstreams)]
+		if taken, ok := tryReserveKey(r.upstreamLimiter, candidate); ok {
+			upstream, reservation = candidate, taken
+			break
+		}
+	}
+	// every upstream is exhausted, wait on the next one in rotation
+	if upstream == "" {
+		upstream = r.upstreams[start%len(r.upstreams)]
+		taken, err := reserveKey(ctx, r.upstreamLimiter, upstream)
+		if err != nil {
+			return "", err
+		}
+		reservation = taken
+	}
+	if r.globalLimiter != nil {
+		if err := r.globalLimiter.TakeContext(ctx); err != nil {
+			// the query is not sent, the upstream token is not spent
+			reservation.Cancel()
+			return "", err
+		}
+	}
+	return upstream, nil
+}
+
+// reserveKey takes one token of key, the reservation is nil when limiter can't take it back
+func reserveKey(ctx context.Context, limiter KeyedLimiter, key string) (*Reservation, error) {
+	if r, ok := limiter.(keyedReserver); ok {
+		return r.Reserve(ctx, key)
+	}
+	return nil, limiter.TakeContext(ctx, key)
+}
+
+// tryReserveKey takes one token of key without waiting, the reservation is nil
+// when limiter can't take it back
+func tryReserveKey(limiter KeyedLimiter, key string) (*Reservation, bool) {
+	if r, ok := limiter.(keyedReserver); ok {
+		reservation, ok, _ := r.TryReserve(key)
+		return reservation, ok
+	}
+	ok, _ := limiter.TryTake(key)
+	return nil, ok
+}
+
+// NetResolveFunc returns a ResolveFunc querying the upstreams with the pure go resolver
+func NetResolveFunc(upstreams ...string) ResolveFunc {
+	resolvers := make(map[string]*net.Resolver, len(upstreams))
+	for _, upstream := range upstreams {
+		resolvers[withDefaultPort(upstream)] = NetResolver(upstream)
+	}
+	return func(ctx context.Context, upstream, name string) ([]string, error) {
+		resolver, ok := resolvers[upstream]
+		if !ok {
+			resolver = NetResolver(upstream)
+		}
+		return resolver.LookupHost(ctx, name)
+	}
+}
+
+// NetResolver returns a *net.Resolver sending all the queries to upstream
+func NetResolver(upstream string) *net.Resolver {
+	upstream = withDefaultPort(upstream)
+	dialer := &net.Dialer{}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, upstream)
+		},
+	}
+}
+
+// withDefaultPort appends the dns port to addresses without one
+func withDefaultPort(address string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(address, "53")
+}
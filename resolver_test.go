@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver(t *testing.T) {
+	var mu sync.Mutex
+	queries := map[string]int{}
+	resolve := func(ctx context.Context, upstream, name string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries[upstream]++
+		return []string{"127.0.0.1"}, nil
+	}
+
+	t.Run("Distributes Across Upstreams", func(t *testing.T) {
+		resolver, err := NewResolver(context.Background(), []string{"1.1.1.1", "8.8.8.8:53"}, 2, time.Hour, WithResolveFunc(resolve))
+		require.Nil(t, err)
+		defer resolver.Stop()
+
+		for i := 0; i < 4; i++ {
+			addrs, err := resolver.Resolve(context.Background(), "example.com")
+			require.Nil(t, err)
+			require.Equal(t, []string{"127.0.0.1"}, addrs)
+		}
+		require.Equal(t, map[string]int{"1.1.1.1:53": 2, "8.8.8.8:53": 2}, queries)
+
+		// all the upstreams are exhausted so the next query waits
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = resolver.Resolve(ctx, "example.com")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Global Limiter", func(t *testing.T) {
+		global := New(context.Background(), 1, time.Hour)
+		defer global.Stop()
+		resolver, err := NewResolver(context.Background(), []string{"1.1.1.1"}, 10, time.Hour, WithResolveFunc(resolve), WithGlobalLimiter(global))
+		require.Nil(t, err)
+		defer resolver.Stop()
+
+		_, err = resolver.Resolve(context.Background(), "example.com")
+		require.Nil(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = resolver.Resolve(ctx, "example.com")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		// the upstream token of the failed query is given back
+		limit, err := resolver.upstreamLimiter.GetLimit("1.1.1.1:53")
+		require.Nil(t, err)
+		limiter, err := resolver.upstreamLimiter.(*AutoLimiter).get("1.1.1.1:53")
+		require.Nil(t, err)
+		require.Equal(t, uint32(limit-1), limiter.count.Load())
+	})
+
+	t.Run("Custom Upstream Limiter", func(t *testing.T) {
+		upstream := NewAutoLimiter(context.Background(), WithMaxCount(1), WithDuration(time.Hour))
+		defer upstream.Stop()
+		resolver, err := NewResolver(context.Background(), []string{"1.1.1.1"}, 0, 0, WithResolveFunc(resolve), WithUpstreamLimiter(upstream))
+		require.Nil(t, err)
+		// the resolver doesn't stop the limiters it doesn't own
+		resolver.Stop()
+		require.Nil(t, upstream.Take("1.1.1.1:53"))
+		ok, err := upstream.TryTake("1.1.1.1:53")
+		require.Nil(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("Existing Resolvers", func(t *testing.T) {
+		lookup := func(addr string) LookupFunc {
+			return func(ctx context.Context, name string) ([]string, error) {
+				return []string{addr}, nil
+			}
+		}
+		resolver, err := NewResolver(context.Background(), nil, 1, time.Hour, WithLookupFuncs(map[string]LookupFunc{
+			"1.1.1.1":    lookup("1.1.1.1"),
+			"8.8.8.8:53": lookup("8.8.8.8"),
+		}))
+		require.Nil(t, err)
+		defer resolver.Stop()
+		require.Equal(t, []string{"1.1.1.1:53", "8.8.8.8:53"}, resolver.upstreams)
+		var addrs []string
+		for i := 0; i < 2; i++ {
+			resolved, err := resolver.Resolve(context.Background(), "example.com")
+			require.Nil(t, err)
+			addrs = append(addrs, resolved...)
+		}
+		require.ElementsMatch(t, []string{"1.1.1.1", "8.8.8.8"}, addrs)
+
+		resolvers := map[string]*net.Resolver{"1.1.1.1": NetResolver("1.1.1.1")}
+		resolver, err = NewResolver(context.Background(), []string{"1.1.1.1:53"}, 1, time.Hour, WithNetResolvers(resolvers))
+		require.Nil(t, err)
+		resolver.Stop()
+		_, err = NewResolver(context.Background(), []string{"8.8.8.8"}, 1, time.Hour, WithNetResolvers(resolvers))
+		require.Error(t, err)
+		_, err = NewResolver(context.Background(), nil, 1, time.Hour, WithNetResolvers(resolvers), WithResolveFunc(resolve))
+		require.Error(t, err)
+	})
+
+	t.Run("Invalid Configuration", func(t *testing.T) {
+		_, err := NewResolver(context.Background(), nil, 1, time.Second)
+		require.Error(t, err)
+		_, err = NewResolver(context.Background(), []string{"1.1.1.1"}, 0, time.Second)
+		require.Error(t, err)
+	})
+}
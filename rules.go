@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"net"
+	"net/netip"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// Matcher selects the keys a Rule applies to
+type Matcher interface {
+	Match(key string) bool
+}
+
+// MatcherFunc is a function that implements Matcher
+type MatcherFunc func(key string) bool
+
+// Match calls f(key)
+func (f MatcherFunc) Match(key string) bool {
+	return f(key)
+}
+
+// MatchExact matches the given keys
+func MatchExact(keys ...string) Matcher {
+	return MatcherFunc(func(key string) bool {
+		return slices.Contains(keys, key)
+	})
+}
+
+// MatchSuffix matches the keys ending with suffix, i.e., .gov
+func MatchSuffix(suffix string) Matcher {
+	return MatcherFunc(func(key string) bool {
+		return strings.HasSuffix(key, suffix)
+	})
+}
+
+// MatchGlob matches the keys with a shell pattern as in path.Match, i.e., *.cloudflare.com
+func MatchGlob(pattern string) (Matcher, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, errkit.Wrapf(err, "invalid glob: %v", pattern)
+	}
+	return MatcherFunc(func(key string) bool {
+		matched, _ := path.Match(pattern, key)
+		return matched
+	}), nil
+}
+
+// MatchRegexp matches the keys with a regular expression
+func MatchRegexp(re *regexp.Regexp) Matcher {
+	return MatcherFunc(re.MatchString)
+}
+
+// MatchCIDR matches the ip keys, with or without a port, within the prefixes
+func MatchCIDR(prefixes ...netip.Prefix) Matcher {
+	return MatcherFunc(func(key string) bool {
+		addr, err := netip.ParseAddr(key)
+		if err != nil {
+			host, _, splitErr := net.SplitHostPort(key)
+			if splitErr != nil {
+				return false
+			}
+			if addr, err = netip.ParseAddr(host); err != nil {
+				return false
+			}
+		}
+		addr = addr.Unmap()
+		for _, prefix := range prefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Rule sets the options of the keys matched by Matcher that were not added with Add
+type Rule struct {
+	Matcher Matcher
+	Options []AutoLimiterOption
+}
+
+// rule is a Rule with the options applied
+type rule struct {
+	matcher Matcher
+	options *internalOptions
+	// err is the error of the options if any
+	err error
+}
+
+// newRule applies the options of r
+func newRule(r Rule) rule {
+	options, err := buildOptions("", r.Options)
+	return rule{matcher: r.Matcher, options: options, err: err}
+}
+
+// validate the matcher and the limits of the rule
+func (r rule) validate() error {
+	if r.matcher == nil {
+		return errkit.New("ratelimit: rule without matcher")
+	}
+	if r.err != nil {
+		return r.err
+	}
+	return r.options.validateLimits()
+}
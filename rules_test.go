@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/netip"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchers(t *testing.T) {
+	require.True(t, MatchExact("a", "b").Match("b"))
+	require.False(t, MatchExact("a").Match("ab"))
+
+	require.True(t, MatchSuffix(".gov").Match("www.nasa.gov"))
+	require.False(t, MatchSuffix(".gov").Match("gov.uk"))
+
+	glob, err := MatchGlob("*.cloudflare.com")
+	require.NoError(t, err)
+	require.True(t, glob.Match("www.cloudflare.com"))
+	require.True(t, glob.Match("a.b.cloudflare.com"))
+	require.False(t, glob.Match("cloudflare.com"))
+	_, err = MatchGlob("[")
+	require.Error(t, err)
+
+	re := MatchRegexp(regexp.MustCompile(`^api\d+\.`))
+	require.True(t, re.Match("api1.example.com"))
+	require.False(t, re.Match("www.example.com"))
+
+	cidr := MatchCIDR(netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32"))
+	require.True(t, cidr.Match("10.1.2.3"))
+	require.True(t, cidr.Match("10.1.2.3:443"))
+	require.True(t, cidr.Match("[2001:db8::1]:80"))
+	require.True(t, cidr.Match("::ffff:10.0.0.1"))
+	require.False(t, cidr.Match("192.168.0.1"))
+	require.False(t, cidr.Match("example.com"))
+}
+
+func TestAutoLimiterRules(t *testing.T) {
+	glob, err := MatchGlob("*.cloudflare.com")
+	require.NoError(t, err)
+	limiter := NewAutoLimiter(context.Background(),
+		WithMaxCount(10), WithDuration(time.Second),
+		WithRules(
+			Rule{Matcher: MatchSuffix(".gov"), Options: []AutoLimiterOption{WithMaxCount(2), WithDuration(time.Second)}},
+			Rule{Matcher: glob, Options: []AutoLimiterOption{WithMaxCount(50), WithDuration(time.Second)}},
+			// never reached for .gov keys, the first matching rule wins
+			Rule{Matcher: MatchExact("www.nasa.gov"), Options: []AutoLimiterOption{WithUnlimited()}},
+		),
+	)
+	defer limiter.Stop()
+
+	for key, expected := range map[string]uint{
+		"www.nasa.gov":       2,
+		"www.cloudflare.com": 50,
+		"example.com":        10,
+	} {
+		limit, err := limiter.GetLimit(key)
+		require.NoError(t, err)
+		require.Equal(t, expected, limit, key)
+		require.NoError(t, limiter.Take(key))
+		limit, err = limiter.GetLimit(key)
+		require.NoError(t, err)
+		require.Equal(t, expected, limit, key)
+	}
+
+	info, err := limiter.Info("www.nasa.gov")
+	require.NoError(t, err)
+	require.Equal(t, OriginRule, info.Origin)
+	info, err = limiter.Info("example.com")
+	require.NoError(t, err)
+	require.Equal(t, OriginDefault, info.Origin)
+
+	// keys added with Add take precedence over the rules
+	require.NoError(t, limiter.Add("www.whitehouse.gov", WithMaxCount(5), WithDuration(time.Second)))
+	limit, err := limiter.GetLimit("www.whitehouse.gov")
+	require.NoError(t, err)
+	require.Equal(t, uint(5), limit)
+
+	// propagated defaults don't apply to keys matched by a rule
+	require.NoError(t, limiter.SetDefaults(WithMaxCount(20), WithDuration(time.Second)))
+	require.NoError(t, limiter.PropagateDefaults())
+	limit, err = limiter.GetLimit("www.nasa.gov")
+	require.NoError(t, err)
+	require.Equal(t, uint(2), limit)
+	limit, err = limiter.GetLimit("example.com")
+	require.NoError(t, err)
+	require.Equal(t, uint(20), limit)
+
+	// new rules apply to the keys created from now on
+	require.NoError(t, limiter.SetRules(Rule{Matcher: MatchSuffix(".org"), Options: []AutoLimiterOption{WithUnlimited()}}))
+	limit, err = limiter.GetLimit("www.example.org")
+	require.NoError(t, err)
+	require.Equal(t, uint(math.MaxUint32), limit)
+	limit, err = limiter.GetLimit("www.nasa.gov")
+	require.NoError(t, err)
+	require.Equal(t, uint(2), limit)
+	limit, err = limiter.GetLimit("www.energy.gov")
+	require.NoError(t, err)
+	require.Equal(t, uint(20), limit)
+
+	require.Error(t, limiter.SetRules(Rule{Matcher: MatchSuffix(".org")}))
+	require.Error(t, limiter.SetRules(Rule{Options: []AutoLimiterOption{WithUnlimited()}}))
+}
+
+func TestInvalidRules(t *testing.T) {
+	ctx := context.Background()
+	rule := Rule{Matcher: MatchSuffix(".gov"), Options: []AutoLimiterOption{WithMaxCount(2)}}
+	require.ErrorIs(t, NewAutoLimiter(ctx, WithMaxCount(10), WithDuration(time.Hour)).SetRules(rule), ErrZeroDuration)
+
+	// the rules given to NewAutoLimiter are checked when a key they match is created
+	limiter := NewAutoLimiter(ctx, WithMaxCount(10), WithDuration(time.Hour), WithRules(rule))
+	defer limiter.Stop()
+	require.ErrorIs(t, limiter.Take("a.gov"), ErrZeroDuration)
+	_, err := limiter.TryTake("a.gov")
+	require.ErrorIs(t, err, ErrZeroDuration)
+	require.NotContains(t, limiter.Keys(), "a.gov")
+	require.NoError(t, limiter.Take("example.com"))
+
+	// so are the rules whose options can't be built
+	nested := Rule{Matcher: MatchSuffix(".org"), Options: []AutoLimiterOption{WithMaxCount(2), WithDuration(time.Hour), WithRules(rule)}}
+	limiter = NewAutoLimiter(ctx, WithMaxCount(10), WithDuration(time.Hour), WithRules(nested))
+	defer limiter.Stop()
+	require.Error(t, limiter.Take("a.org"))
+	_, err = limiter.GetLimit("a.org")
+	require.Error(t, err)
+	require.NotContains(t, limiter.Keys(), "a.org")
+	require.NoError(t, limiter.Take("example.com"))
+
+	// keys without valid defaults fail the same way
+	require.ErrorIs(t, NewAutoLimiter(ctx).Take("key"), ErrZeroMaxCount)
+}
@@ -0,0 +1,358 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// StateVersion is the version of the snapshots taken by this package
+const StateVersion = 1
+
+// LimiterState is a snapshot of a Limiter, it can be encoded with json or gob
+type LimiterState struct {
+	Version   int           `json:"version"`
+	Strategy  Strategy      `json:"strategy"`
+	MaxCount  uint          `json:"max_count"`
+	Duration  time.Duration `json:"duration"`
+	Unlimited bool          `json:"unlimited,omitempty"`
+	// Tokens left in the current window
+	Tokens uint `json:"tokens"`
+	// WindowStart is the time of the last refill, zero for the LeakyBucket strategy
+	WindowStart time.Time `json:"window_start"`
+	// Warmup is the warm-up in progress if any
+	Warmup *WarmupState `json:"warmup,omitempty"`
+}
+
+// WarmupState is the snapshot of a warm-up in progress
+type WarmupState struct {
+	Warmup
+	Started time.Time `json:"started"`
+}
+
+// KeyState is the snapshot of a key of a keyed limiter
+type KeyState struct {
+	// Custom are the options of a key added or updated with its own settings
+	Custom *OptionsState `json:"custom,omitempty"`
+	// Limiter is the state of the key limiter if it exists
+	Limiter *LimiterState `json:"limiter,omitempty"`
+}
+
+// OptionsState is the snapshot of the options of a key, the parents are not part of it
+type OptionsState struct {
+	MaxCount  uint          `json:"max_count,omitempty"`
+	Duration  time.Duration `json:"duration,omitempty"`
+	Unlimited bool          `json:"unlimited,omitempty"`
+	FIFO      bool          `json:"fifo,omitempty"`
+	MaxQueue  int           `json:"max_queue,omitempty"`
+	MaxWait   time.Duration `json:"max_wait,omitempty"`
+	Warmup    *Warmup       `json:"warmup,omitempty"`
+}
+
+// optionsState returns the snapshot of opts
+func optionsState(opts *Options) *OptionsState {
+	state := &OptionsState{
+		MaxCount:  opts.MaxCount,
+		Duration:  opts.Duration,
+		Unlimited: opts.IsUnlimited,
+		FIFO:      opts.FIFO,
+		MaxQueue:  opts.MaxQueue,
+		MaxWait:   opts.MaxWait,
+	}
+	if opts.Warmup != nil {
+		warmup := *opts.Warmup
+		state.Warmup = &warmup
+	}
+	return state
+}
+
+// apply the saved options over opts keeping its key and its parent
+func (state *OptionsState) apply(opts *Options) {
+	opts.MaxCount, opts.Duration, opts.IsUnlimited = state.MaxCount, state.Duration, state.Unlimited
+	opts.FIFO, opts.MaxQueue, opts.MaxWait = state.FIFO, state.MaxQueue, state.MaxWait
+	opts.Warmup = nil
+	if state.Warmup != nil {
+		warmup := *state.Warmup
+		opts.Warmup = &warmup
+	}
+}
+
+// KeyedState is a snapshot of a MultiLimiter or an AutoLimiter, it can be encoded with json or gob
+type KeyedState struct {
+	Version int                 `json:"version"`
+	Keys    map[string]KeyState `json:"keys"`
+}
+
+// Snapshot returns the configuration and the tokens left in the current window
+func (limiter *Limiter) Snapshot() LimiterState {
+	state := LimiterState{
+		Version:   StateVersion,
+		Strategy:  limiter.strategy,
+		MaxCount:  limiter.GetLimit(),
+		Duration:  limiter.getDuration(),
+		Unlimited: limiter.strategy != LeakyBucket && limiter.maxCount.Load() == math.MaxUint32,
+	}
+	switch limiter.strategy {
+	case LeakyBucket:
+		if tokens := limiter.leakyBucketLimiter.Tokens(); tokens > 0 {
+			state.Tokens = uint(tokens)
+		}
+	default:
+		state.Tokens = uint(limiter.count.Load())
+		state.WindowStart = time.Unix(0, limiter.windowStart.Load())
+		if warmup := limiter.warmup.Load(); warmup != nil {
+			state.Warmup = &WarmupState{Warmup: warmup.Warmup, Started: warmup.started}
+		}
+	}
+	return state
+}
+
+// Restore reconfigures the limiter with the state and continues its window and its warm-up,
+// the tokens spent in the window count against the limit and a window
+// that is over in the meantime starts with a full bucket
+func (limiter *Limiter) Restore(state LimiterState) error {
+	if err := validateState(state.Version); err != nil {
+		return err
+	}
+	if state.Strategy != limiter.strategy {
+		return errkit.Newf("ratelimit: can't restore a %v state in a %v limiter", state.Strategy, limiter.strategy)
+	}
+	if !state.Unlimited && (state.MaxCount == 0 || state.Duration == 0) {
+		return errkit.New("ratelimit: invalid state limits")
+	}
+	if state.Warmup != nil {
+		if err := state.Warmup.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := limiter.update(state.Unlimited, state.MaxCount, state.Duration, limiter.Parent(), true); err != nil {
+		return err
+	}
+	return limiter.restoreWindow(state)
+}
+
+// restoreWindow restores the tokens, the window and the warm-up of state keeping the current limits,
+// a state without warm-up ends the current one
+func (limiter *Limiter) restoreWindow(state LimiterState) error {
+	if limiter.strategy != LeakyBucket {
+		if state.Warmup == nil {
+			limiter.warmup.Store(nil)
+		} else {
+			if err := state.Warmup.Validate(); err != nil {
+				return err
+			}
+			limiter.warmup.Store(&warmupState{Warmup: state.Warmup.Warmup, started: state.Warmup.Started})
+		}
+	}
+	spent := uint32(0)
+	if limit := state.windowLimit(); limit > state.Tokens {
+		spent = uint32(min(limit-state.Tokens, math.MaxUint32))
+	}
+	maxCount := limiter.maxCount.Load()
+	if warmup := limiter.warmup.Load(); warmup != nil && !state.WindowStart.IsZero() {
+		maxCount, _ = warmup.limit(maxCount, limiter.getDuration(), state.WindowStart)
+	}
+	tokens := maxCount - min(spent, maxCount)
+
+	switch limiter.strategy {
+	case LeakyBucket:
+		// tokens are spent by reserving them
+		if current := limiter.leakyBucketLimiter.Tokens(); current > float64(tokens) {
+			limiter.leakyBucketLimiter.ReserveN(time.Now(), int(current-float64(tokens)))
+		}
+	default:
+		duration := limiter.getDuration()
+		elapsed := time.Since(state.WindowStart)
+		if state.WindowStart.IsZero() || state.Duration != duration || elapsed < 0 || elapsed >= duration {
+			// the window is over or not comparable, the current one goes on
+			return nil
+		}
+		limiter.windowStart.Store(state.WindowStart.UnixNano())
+		// the next refill ends the restored window
+		limiter.realign.Store(true)
+		limiter.ticker.Reset(duration - elapsed)
+		limiter.refill(tokens)
+	}
+	return nil
+}
+
+// windowLimit returns the tokens of the saved window
+func (state LimiterState) windowLimit() uint {
+	if state.Warmup == nil || state.WindowStart.IsZero() {
+		return state.MaxCount
+	}
+	warmup := warmupState{Warmup: state.Warmup.Warmup, started: state.Warmup.Started}
+	limit, _ := warmup.limit(uint32(min(state.MaxCount, math.MaxUint32)), state.Duration, state.WindowStart)
+	return uint(limit)
+}
+
+// keyedSnapshotter is a keyed limiter whose keys can be saved and restored
+type keyedSnapshotter interface {
+	// Keys returns the sorted keys that were added or used
+	Keys() []string
+	// customOptions returns the options of key if it has its own settings
+	customOptions(key string) (*Options, bool)
+	// existing returns the limiter of key if it exists
+	existing(key string) (*Limiter, bool)
+	// restoreOptions applies the saved options over the current options of key
+	restoreOptions(key string, custom *OptionsState) error
+	// limiterFor returns the limiter of key creating it if needed
+	limiterFor(key string) (*Limiter, error)
+}
+
+// snapshotKeys returns the custom options of the keys and the state of their limiters
+func snapshotKeys(k keyedSnapshotter) KeyedState {
+	state := KeyedState{Version: StateVersion, Keys: make(map[string]KeyState)}
+	for _, key := range k.Keys() {
+		var keyState KeyState
+		if opts, ok := k.customOptions(key); ok {
+			keyState.Custom = optionsState(opts)
+		}
+		if limiter, ok := k.existing(key); ok {
+			limiterState := limiter.Snapshot()
+			keyState.Limiter = &limiterState
+		}
+		state.Keys[key] = keyState
+	}
+	return state
+}
+
+// restoreKeys restores the custom options of the keys and the windows of their limiters
+func restoreKeys(k keyedSnapshotter, state KeyedState) error {
+	if err := validateState(state.Version); err != nil {
+		return err
+	}
+	var errs error
+	for key, keyState := range state.Keys {
+		if err := restoreKey(k, key, keyState); err != nil {
+			errs = errkit.Append(errs, errkit.Wrapf(err, "key: %v", key))
+		}
+	}
+	return errs
+}
+
+// restoreKey restores the options and the window of key
+func restoreKey(k keyedSnapshotter, key string, state KeyState) error {
+	if state.Custom != nil {
+		if err := k.restoreOptions(key, state.Custom); err != nil {
+			return err
+		}
+	}
+	if state.Limiter == nil {
+		return nil
+	}
+	limiter, err := k.limiterFor(key)
+	if err != nil {
+		return err
+	}
+	if state.Limiter.Strategy == limiter.strategy {
+		return limiter.restoreWindow(*state.Limiter)
+	}
+	return nil
+}
+
+// Snapshot returns the custom options of the keys and the state of their limiters
+func (m *MultiLimiter) Snapshot() KeyedState {
+	return snapshotKeys(m)
+}
+
+// Restore the custom options of the keys and the windows of their limiters,
+// keys without custom options use the current defaults
+func (m *MultiLimiter) Restore(state KeyedState) error {
+	return restoreKeys(m, state)
+}
+
+// customOptions returns the options of key if it was added or updated
+func (m *MultiLimiter) customOptions(key string) (*Options, bool) {
+	val, _ := m.options.Load(key)
+	opts, ok := val.(*Options)
+	return opts, ok
+}
+
+// existing returns the limiter of key if it exists
+func (m *MultiLimiter) existing(key string) (*Limiter, bool) {
+	val, _ := m.limiters.Load(key)
+	limiter, ok := val.(*Limiter)
+	return limiter, ok
+}
+
+// restoreOptions applies the saved options over the custom or default options of key
+func (m *MultiLimiter) restoreOptions(key string, custom *OptionsState) error {
+	var opts Options
+	// the parent is not part of the state
+	if current, ok := m.customOptions(key); ok {
+		opts = *current
+	} else if defaults := m.defaults.Load(); defaults != nil {
+		opts = *defaults
+	}
+	opts.Key = key
+	custom.apply(&opts)
+	return m.configureKey(&opts)
+}
+
+// limiterFor returns the limiter of key creating it if needed
+func (m *MultiLimiter) limiterFor(key string) (*Limiter, error) {
+	return m.get(key)
+}
+
+// Snapshot returns the custom options of the keys and the state of their limiters
+func (e *AutoLimiter) Snapshot() KeyedState {
+	return snapshotKeys(e)
+}
+
+// Restore the custom options of the keys and the windows of their limiters,
+// keys without custom options use the current rules and defaults
+func (e *AutoLimiter) Restore(state KeyedState) error {
+	return restoreKeys(e, state)
+}
+
+// customOptions returns the options of key if it was added or updated
+func (e *AutoLimiter) customOptions(key string) (*Options, bool) {
+	val, _ := e.options.Load(key)
+	if opts, ok := val.(*internalOptions); ok {
+		return &opts.Options, true
+	}
+	return nil, false
+}
+
+// existing returns the limiter of key if it exists
+func (e *AutoLimiter) existing(key string) (*Limiter, bool) {
+	limiter, err := e.get(key)
+	return limiter, err == nil
+}
+
+// restoreOptions applies the saved options over the custom, rule or default options of key
+func (e *AutoLimiter) restoreOptions(key string, custom *OptionsState) error {
+	// the parents are not part of the state
+	current, err := e.optionsOf(key)
+	if err != nil {
+		return err
+	}
+	opts := *current
+	opts.Key = key
+	custom.apply(&opts.Options)
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if limiter, err := e.get(key); err == nil {
+		if err := opts.configure(limiter, true); err != nil {
+			return err
+		}
+	}
+	e.options.Store(key, &opts)
+	return nil
+}
+
+// limiterFor returns the limiter of key creating it if needed
+func (e *AutoLimiter) limiterFor(key string) (*Limiter, error) {
+	return e.getOrCreate(key)
+}
+
+// validateState checks the version of a snapshot
+func validateState(version int) error {
+	if version != StateVersion {
+		return errkit.Newf("ratelimit: unsupported state version %d", version)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterSnapshot(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(ctx, 5, time.Second)
+	defer limiter.Stop()
+	for i := 0; i < 3; i++ {
+		require.True(t, limiter.TryTake())
+	}
+	state := limiter.Snapshot()
+	require.Equal(t, uint(2), state.Tokens)
+
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+	var decoded LimiterState
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.True(t, decoded.WindowStart.Equal(state.WindowStart))
+
+	// the resumed limiter continues the window instead of starting with a full bucket
+	resumed := New(ctx, 1, time.Hour)
+	defer resumed.Stop()
+	require.NoError(t, resumed.Restore(decoded))
+	require.Equal(t, uint(5), resumed.GetLimit())
+	require.True(t, resumed.TryTake())
+	require.True(t, resumed.TryTake())
+	require.False(t, resumed.TryTake())
+	// and refills when the window ends
+	start := time.Now()
+	require.NoError(t, resumed.TakeContext(ctx))
+	require.Less(t, time.Since(start), time.Second+100*time.Millisecond)
+	require.Equal(t, time.Second, resumed.getDuration())
+
+	// a window that is over starts with a full bucket
+	decoded.WindowStart = time.Now().Add(-time.Hour)
+	fresh := New(ctx, 5, time.Second)
+	defer fresh.Stop()
+	require.NoError(t, fresh.Restore(decoded))
+	require.Equal(t, uint32(5), fresh.count.Load())
+
+	decoded.Version = StateVersion + 1
+	require.Error(t, fresh.Restore(decoded))
+	require.Error(t, NewLeakyBucket(ctx, 5, time.Second).Restore(state))
+}
+
+func TestWarmupSnapshot(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(ctx, 100, time.Hour)
+	defer limiter.Stop()
+	require.NoError(t, limiter.SetWarmup(Warmup{Start: 10, Windows: 4}))
+	for range 3 {
+		require.True(t, limiter.TryTake())
+	}
+	state := limiter.Snapshot()
+	require.NotNil(t, state.Warmup)
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+	var decoded LimiterState
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	// the warm-up goes on from where it was
+	resumed := New(ctx, 100, time.Hour)
+	defer resumed.Stop()
+	require.NoError(t, resumed.Restore(decoded))
+	require.Equal(t, uint32(7), resumed.count.Load())
+	warmup := resumed.warmup.Load()
+	require.NotNil(t, warmup)
+	require.True(t, warmup.started.Equal(state.Warmup.Started))
+	require.Equal(t, Warmup{Start: 10, Windows: 4}, warmup.Warmup)
+
+	// a state without warm-up ends the current one
+	plain := New(ctx, 100, time.Hour)
+	defer plain.Stop()
+	require.NoError(t, resumed.Restore(plain.Snapshot()))
+	require.Nil(t, resumed.warmup.Load())
+
+	decoded.Warmup.Start = 0
+	require.Error(t, resumed.Restore(decoded))
+}
+
+func TestLeakyBucketSnapshot(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLeakyBucket(ctx, 3, time.Hour)
+	require.True(t, limiter.TryTake())
+	require.True(t, limiter.TryTake())
+	state := limiter.Snapshot()
+	require.Equal(t, uint(1), state.Tokens)
+
+	resumed := NewLeakyBucket(ctx, 3, time.Hour)
+	require.NoError(t, resumed.Restore(state))
+	require.True(t, resumed.TryTake())
+	require.False(t, resumed.TryTake())
+}
+
+func TestKeyedSnapshot(t *testing.T) {
+	ctx := context.Background()
+	auto := NewAutoLimiter(ctx, WithMaxCount(3), WithDuration(time.Hour))
+	defer auto.Stop()
+	require.NoError(t, auto.Add("custom", WithMaxCount(2), WithDuration(time.Hour)))
+	require.NoError(t, auto.Take("custom"))
+	require.NoError(t, auto.Take("auto"))
+	require.NoError(t, auto.Take("auto"))
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(auto.Snapshot()))
+	var state KeyedState
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&state))
+	require.NotNil(t, state.Keys["custom"].Custom)
+	require.Nil(t, state.Keys["auto"].Custom)
+
+	resumed := NewAutoLimiter(ctx, WithMaxCount(3), WithDuration(time.Hour))
+	defer resumed.Stop()
+	require.NoError(t, resumed.Restore(state))
+	info, err := resumed.Info("custom")
+	require.NoError(t, err)
+	require.Equal(t, OriginCustom, info.Origin)
+	require.Equal(t, uint(2), info.Limit)
+	for key, left := range map[string]int{"custom": 1, "auto": 1} {
+		for i := 0; i < left; i++ {
+			ok, err := resumed.TryTake(key)
+			require.NoError(t, err)
+			require.True(t, ok, key)
+		}
+		ok, err := resumed.TryTake(key)
+		require.NoError(t, err)
+		require.False(t, ok, key)
+	}
+
+	multi, err := NewMultiLimiter(ctx, &Options{Key: "custom", MaxCount: 2, Duration: time.Hour})
+	require.NoError(t, err)
+	defer multi.Stop()
+	require.NoError(t, multi.SetDefaults(&Options{MaxCount: 3, Duration: time.Hour}))
+	require.NoError(t, multi.Take("custom"))
+	require.NoError(t, multi.Take("auto"))
+	data, err := json.Marshal(multi.Snapshot())
+	require.NoError(t, err)
+	state = KeyedState{}
+	require.NoError(t, json.Unmarshal(data, &state))
+
+	// the keys without custom options need defaults to be restored
+	resumedMulti := &MultiLimiter{ctx: ctx}
+	defer resumedMulti.Stop()
+	require.Error(t, resumedMulti.Restore(state))
+	require.NoError(t, resumedMulti.SetDefaults(&Options{MaxCount: 3, Duration: time.Hour}))
+	require.NoError(t, resumedMulti.Restore(state))
+	ok, err := resumedMulti.TryTake("custom")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = resumedMulti.TryTake("custom")
+	require.NoError(t, err)
+	require.False(t, ok)
+	info, err = resumedMulti.Info("auto")
+	require.NoError(t, err)
+	require.Equal(t, OriginDefault, info.Origin)
+	auto2, err := resumedMulti.get("auto")
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), auto2.count.Load())
+}
+
+func TestKeyedSnapshotOptions(t *testing.T) {
+	ctx := context.Background()
+	warmup := Warmup{Start: 1, Windows: 3}
+	opts := &Options{Key: "key", MaxCount: 5, Duration: time.Hour, FIFO: true, MaxQueue: 4, MaxWait: time.Minute, Warmup: &warmup}
+	multi, err := NewMultiLimiter(ctx, opts)
+	require.NoError(t, err)
+	defer multi.Stop()
+
+	// restoring in place keeps the options of the live key
+	require.NoError(t, multi.Restore(multi.Snapshot()))
+	limiter, err := multi.get("key")
+	require.NoError(t, err)
+	require.True(t, limiter.queue.fifo)
+	require.Equal(t, 4, limiter.queue.maxQueue)
+	require.Equal(t, time.Minute, limiter.queue.maxWait)
+
+	data, err := json.Marshal(multi.Snapshot())
+	require.NoError(t, err)
+	var state KeyedState
+	require.NoError(t, json.Unmarshal(data, &state))
+
+	// and a fresh process gets them from the state
+	resumedMulti := &MultiLimiter{ctx: ctx}
+	defer resumedMulti.Stop()
+	require.NoError(t, resumedMulti.Restore(state))
+	custom, ok := resumedMulti.customOptions("key")
+	require.True(t, ok)
+	require.Equal(t, opts, custom)
+
+	auto := NewAutoLimiter(ctx, WithMaxCount(3), WithDuration(time.Hour))
+	defer auto.Stop()
+	require.NoError(t, auto.Add("key", WithMaxCount(5), WithDuration(time.Hour), WithFIFO(), WithMaxQueue(4), WithMaxWait(time.Minute), WithWarmup(warmup)))
+	resumed := NewAutoLimiter(ctx, WithMaxCount(3), WithDuration(time.Hour))
+	defer resumed.Stop()
+	require.NoError(t, resumed.Restore(auto.Snapshot()))
+	custom, ok = resumed.customOptions("key")
+	require.True(t, ok)
+	require.Equal(t, opts, custom)
+	limiter, err = resumed.get("key")
+	require.NoError(t, err)
+	require.True(t, limiter.queue.fifo)
+	require.Equal(t, 4, limiter.queue.maxQueue)
+	require.Equal(t, time.Minute, limiter.queue.maxWait)
+}
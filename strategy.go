@@ -1,8 +1,38 @@
 package ratelimit
 
+import "github.com/projectdiscovery/utils/errkit"
+
 type Strategy uint8
 
 const (
 	None Strategy = iota
 	LeakyBucket
 )
+
+// String returns the name of the strategy
+func (s Strategy) String() string {
+	switch s {
+	case LeakyBucket:
+		return "leaky-bucket"
+	default:
+		return "none"
+	}
+}
+
+// MarshalText returns the name of the strategy
+func (s Strategy) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText parses the name of a strategy, empty means None
+func (s *Strategy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "", "none":
+		*s = None
+	case "leaky-bucket":
+		*s = LeakyBucket
+	default:
+		return errkit.Newf("ratelimit: unknown strategy %q", string(text))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+
+	"github.com/projectdiscovery/utils/errkit"
+)
+
+// Ramp is the shape of a warm-up
+type Ramp int
+
+const (
+	// RampLinear raises the limit by the same amount every window
+	RampLinear Ramp = iota
+	// RampExponential multiplies the limit by the same factor every window
+	RampExponential
+)
+
+// Warmup ramps the limit of a limiter from Start to its maximum count
+// over Windows refills or over Period, whichever is set
+type Warmup struct {
+	Start   uint          `json:"start"`
+	Windows uint          `json:"windows,omitempty"`
+	Period  time.Duration `json:"period,omitempty"`
+	Ramp    Ramp          `json:"ramp,omitempty"`
+}
+
+// Validate the warm-up settings
+func (w Warmup) Validate() error {
+	if w.Start == 0 {
+		return errkit.New("ratelimit: warm-up start cannot be zero")
+	}
+	if (w.Windows == 0) == (w.Period <= 0) {
+		return errkit.New("ratelimit: warm-up needs either windows or a period")
+	}
+	if w.Ramp != RampLinear && w.Ramp != RampExponential {
+		return errkit.Newf("ratelimit: unknown warm-up ramp %d", w.Ramp)
+	}
+	return nil
+}
+
+// warmupState is a warm-up in progress
+type warmupState struct {
+	Warmup
+	started time.Time
+}
+
+// SetWarmup starts a warm-up from now, the current window is cut down to the start
+// keeping the tokens already spent, the zero Warmup stops it
+func (limiter *Limiter) SetWarmup(w Warmup) error {
+	if w == (Warmup{}) {
+		limiter.warmup.Store(nil)
+		return nil
+	}
+	if limiter.strategy == LeakyBucket {
+		return errkit.New("ratelimit: warm-up not supported by the LeakyBucket strategy")
+	}
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	maxCount := limiter.maxCount.Load()
+	limiter.warmup.Store(&warmupState{Warmup: w, started: time.Now()})
+	start := limiter.windowLimit(maxCount)
+	for {
+		count := limiter.count.Load()
+		spent := maxCount - min(count, maxCount)
+		next := start - min(spent, start)
+		if next >= count || limiter.count.CompareAndSwap(count, next) {
+			return nil
+		}
+	}
+}
+
+// windowLimit returns the tokens of a window starting now given the maximum count
+func (limiter *Limiter) windowLimit(maxCount uint32) uint32 {
+	state := limiter.warmup.Load()
+	if state == nil {
+		return maxCount
+	}
+	limit, over := state.limit(maxCount, limiter.getDuration(), time.Now())
+	if over {
+		limiter.warmup.CompareAndSwap(state, nil)
+	}
+	return limit
+}
+
+// limit returns the tokens of a window of duration starting at the given time
+// and whether the warm-up is over by then
+func (state *warmupState) limit(maxCount uint32, duration time.Duration, at time.Time) (uint32, bool) {
+	if maxCount == 0 || maxCount == math.MaxUint32 {
+		return maxCount, false
+	}
+	total := state.Period
+	if state.Windows > 0 {
+		total = time.Duration(state.Windows) * duration
+	}
+	progress := float64(at.Sub(state.started)) / float64(total)
+	start := float64(min(uint32(min(state.Start, math.MaxUint32)), maxCount))
+	if progress >= 1 || total <= 0 {
+		return maxCount, true
+	}
+	var limit float64
+	switch state.Ramp {
+	case RampExponential:
+		limit = start * math.Pow(float64(maxCount)/start, progress)
+	default:
+		limit = start + (float64(maxCount)-start)*progress
+	}
+	return uint32(min(max(limit, start), float64(maxCount))), false
+}
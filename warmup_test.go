@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmup(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(ctx, 100, time.Hour)
+	defer limiter.Stop()
+	require.Error(t, limiter.SetWarmup(Warmup{Windows: 4}))
+	require.Error(t, limiter.SetWarmup(Warmup{Start: 10}))
+	require.Error(t, limiter.SetWarmup(Warmup{Start: 10, Windows: 4, Period: time.Hour}))
+	require.Error(t, NewLeakyBucket(ctx, 100, time.Hour).SetWarmup(Warmup{Start: 10, Windows: 4}))
+
+	// the current window keeps the tokens already spent
+	for range 5 {
+		require.True(t, limiter.TryTake())
+	}
+	require.NoError(t, limiter.SetWarmup(Warmup{Start: 10, Windows: 4}))
+	require.Equal(t, uint32(5), limiter.count.Load())
+	limiter.giveBack(limiter.window.Load(), 10)
+	require.Equal(t, uint32(10), limiter.count.Load())
+
+	// halfway through the ramp
+	limiter.warmup.Load().started = time.Now().Add(-2 * time.Hour)
+	require.Equal(t, uint32(55), limiter.windowLimit(100))
+	require.NoError(t, limiter.SetWarmup(Warmup{Start: 10, Period: 4 * time.Hour, Ramp: RampExponential}))
+	limiter.warmup.Load().started = time.Now().Add(-2 * time.Hour)
+	require.Equal(t, uint32(31), limiter.windowLimit(100))
+
+	// the ramp is over
+	limiter.warmup.Load().started = time.Now().Add(-4 * time.Hour)
+	require.Equal(t, uint32(100), limiter.windowLimit(100))
+	require.Nil(t, limiter.warmup.Load())
+	require.NoError(t, limiter.SetWarmup(Warmup{Start: 10, Windows: 4}))
+	require.NoError(t, limiter.SetWarmup(Warmup{}))
+	require.Equal(t, uint32(100), limiter.windowLimit(100))
+}
+
+func TestWarmupRefill(t *testing.T) {
+	limiter := New(context.Background(), 1000, 10*time.Millisecond)
+	defer limiter.Stop()
+	require.NoError(t, limiter.SetWarmup(Warmup{Start: 5, Period: time.Hour}))
+	for limiter.TryTake() {
+	}
+	require.Eventually(t, func() bool {
+		return limiter.count.Load() > 0
+	}, 5*time.Second, time.Millisecond)
+	require.LessOrEqual(t, limiter.count.Load(), uint32(5))
+}
+
+func TestKeyedWarmup(t *testing.T) {
+	ctx := context.Background()
+	auto := NewAutoLimiter(ctx, WithMaxCount(100), WithDuration(time.Hour), WithWarmup(Warmup{Start: 10, Windows: 5}))
+	defer auto.Stop()
+	require.NoError(t, auto.Take("key"))
+	keyLimiter, err := auto.get("key")
+	require.NoError(t, err)
+	require.Equal(t, uint32(9), keyLimiter.count.Load())
+	// the ramp doesn't restart on updates
+	require.NoError(t, auto.Update("key", WithMaxCount(200), WithDuration(time.Hour)))
+	require.Equal(t, uint32(9), keyLimiter.count.Load())
+	require.Error(t, auto.Add("invalid", WithMaxCount(1), WithDuration(time.Hour), WithWarmup(Warmup{Windows: 1})))
+
+	multi, err := NewMultiLimiter(ctx, &Options{Key: "key", MaxCount: 100, Duration: time.Hour, Warmup: &Warmup{Start: 1, Windows: 3}})
+	require.NoError(t, err)
+	defer multi.Stop()
+	require.NoError(t, multi.Take("key"))
+	require.False(t, multi.CanTake("key"))
+	_, err = NewMultiLimiter(ctx, &Options{Key: "key", MaxCount: 100, Duration: time.Hour, Warmup: &Warmup{Start: 1}})
+	require.Error(t, err)
+}